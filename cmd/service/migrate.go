@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/112Alex/demo-service.git/internal/app"
+	"github.com/112Alex/demo-service.git/internal/config"
+)
+
+const migrateUsage = `Использование: demo-service migrate <команда>
+  up        применить все новые миграции
+  down [N]  откатить N последних миграций (по умолчанию 1)
+  status    показать состояние миграций`
+
+// runMigrate выполняет подкоманду migrate и возвращает код завершения.
+func runMigrate(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Println(migrateUsage)
+		return 2
+	}
+
+	dbClient, err := app.ConnectDB(cfg)
+	if err != nil {
+		log.Printf("Не удалось подключиться к БД: %v", err)
+		return 1
+	}
+	defer dbClient.Close()
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := dbClient.MigrateUp(ctx)
+		if err != nil {
+			log.Printf("Ошибка применения миграций: %v", err)
+			return 1
+		}
+		log.Printf("Применено миграций: %d", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				log.Printf("Некорректное число миграций: %s", args[1])
+				return 2
+			}
+		}
+		reverted, err := dbClient.MigrateDown(ctx, steps)
+		if err != nil {
+			log.Printf("Ошибка отката миграций: %v", err)
+			return 1
+		}
+		log.Printf("Откачено миграций: %d", reverted)
+	case "status":
+		statuses, err := dbClient.MigrationStatuses(ctx)
+		if err != nil {
+			log.Printf("Ошибка получения состояния миграций: %v", err)
+			return 1
+		}
+		for _, st := range statuses {
+			applied := "не применена"
+			if st.AppliedAt != nil {
+				applied = st.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%04d  %-30s  %s\n", st.Version, st.Name, applied)
+		}
+	default:
+		fmt.Println(migrateUsage)
+		return 2
+	}
+	return 0
+}
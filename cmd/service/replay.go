@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/config"
+	"github.com/112Alex/demo-service.git/internal/kafka"
+)
+
+// runReplayDLQ выполняет подкоманду replay-dlq и возвращает код завершения.
+func runReplayDLQ(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("replay-dlq", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Использование: demo-service replay-dlq [флаги]\nПереотправляет сообщения из DLQ в основной топик.")
+		fs.PrintDefaults()
+	}
+	var (
+		filter    kafka.ReplayFilter
+		from, to  string
+		positions string
+		dryRun    bool
+		timeout   time.Duration
+	)
+	fs.StringVar(&filter.Reason, "reason", "", "подстрока причины ошибки (без учета регистра)")
+	fs.StringVar(&filter.OrderUID, "order-uid", "", "order_uid сообщения")
+	fs.StringVar(&from, "from", "", "время попадания в DLQ не раньше (RFC3339)")
+	fs.StringVar(&to, "to", "", "время попадания в DLQ раньше (RFC3339)")
+	fs.StringVar(&positions, "positions", "", "позиции сообщений в DLQ partition:offset через запятую")
+	fs.IntVar(&filter.Limit, "limit", kafka.DefaultReplayLimit, "максимальное число сообщений")
+	fs.BoolVar(&dryRun, "dry-run", false, "только показать сообщения, не переотправляя их")
+	fs.BoolVar(&filter.IncludeReplayed, "force", false, "включить уже переотправленные сообщения")
+	fs.DurationVar(&timeout, "timeout", kafka.DefaultReplayTimeout, "максимальное время чтения DLQ и переотправки")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var err error
+	if from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			log.Printf("Некорректный -from: %v", err)
+			return 2
+		}
+	}
+	if to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			log.Printf("Некорректный -to: %v", err)
+			return 2
+		}
+	}
+	if filter.Positions, err = parsePositions(positions); err != nil {
+		log.Printf("Некорректный -positions: %v", err)
+		return 2
+	}
+	if timeout <= 0 {
+		log.Printf("Некорректный -timeout: должен быть больше нуля")
+		return 2
+	}
+
+	dlq := kafka.NewDLQ(cfg)
+	defer dlq.Close()
+
+	// Чтение раздела DLQ блокируется, если брокер недоступен или ожидаемое смещение
+	// так и не приходит, поэтому время работы команды ограничено.
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	res, err := dlq.Replay(ctx, filter, dryRun)
+	if err != nil {
+		log.Printf("Ошибка переотправки сообщений DLQ: %v", err)
+		return 1
+	}
+
+	for _, m := range res.Messages {
+		md := m.Metadata
+		fmt.Fprintf(os.Stdout, "%d:%d\t%s\t%s\t%s\t%d\t%s\n",
+			m.Partition, m.Offset, m.OrderUID, md.FailedAt.Format(time.RFC3339), md.ErrorClass, md.Attempts, md.Reason)
+	}
+	if dryRun {
+		log.Printf("Найдено сообщений: %d (dry-run, ничего не отправлено)", len(res.Messages))
+	} else {
+		log.Printf("Переотправлено сообщений в %s: %d", cfg.KafkaTopic, len(res.Messages))
+	}
+	return 0
+}
+
+// parsePositions разбирает список "partition:offset,partition:offset".
+func parsePositions(value string) ([]kafka.Position, error) {
+	var positions []kafka.Position
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		p, o, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("ожидается partition:offset, получено %q", part)
+		}
+		partition, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный partition %q", p)
+		}
+		offset, err := strconv.ParseInt(o, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный offset %q", o)
+		}
+		positions = append(positions, kafka.Position{Partition: partition, Offset: offset})
+	}
+	return positions, nil
+}
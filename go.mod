@@ -4,10 +4,13 @@ go 1.24.0
 
 require (
 	github.com/lib/pq v1.10.9
+	github.com/linkedin/goavro/v2 v2.12.0
 	github.com/segmentio/kafka-go v0.4.48
+	google.golang.org/protobuf v1.36.11
 )
 
 require (
+	github.com/golang/snappy v0.0.1 // indirect
 	github.com/klauspost/compress v1.15.9 // indirect
 	github.com/pierrec/lz4/v4 v4.1.15 // indirect
 )
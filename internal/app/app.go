@@ -0,0 +1,119 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/cache"
+	"github.com/112Alex/demo-service.git/internal/config"
+	"github.com/112Alex/demo-service.git/internal/db"
+	"github.com/112Alex/demo-service.git/internal/health"
+	"github.com/112Alex/demo-service.git/internal/ingest"
+	"github.com/112Alex/demo-service.git/internal/kafka"
+	"github.com/112Alex/demo-service.git/internal/outbox"
+	"github.com/112Alex/demo-service.git/internal/retry"
+	"github.com/112Alex/demo-service.git/internal/rules"
+	"github.com/112Alex/demo-service.git/internal/server"
+	"github.com/112Alex/demo-service.git/internal/warmup"
+)
+
+// maxRestartDelay bounds the backoff between restarts of a crashed component.
+const maxRestartDelay = time.Minute
+
+// Run builds the service from cfg and runs it until ctx is cancelled or a
+// component crashes for good. It returns nil only for a clean shutdown.
+func Run(ctx context.Context, cfg *config.Config) error {
+	ruleEngine, err := NewRuleEngine(cfg)
+	if err != nil {
+		return fmt.Errorf("ошибка конфигурации бизнес-правил: %w", err)
+	}
+	dbClient, err := ConnectDB(cfg)
+	if err != nil {
+		return fmt.Errorf("не удалось подключиться к БД: %w", err)
+	}
+
+	orderCache := cache.NewCache(cfg.CacheCapacity, cfg.CacheTTL)
+	healthChecks := health.NewRegistry()
+
+	// Async cache warmup: the HTTP server is ready at once, progress is shown in /health
+	warmer := warmup.NewWarmer(dbClient, orderCache, cfg.CacheCapacity, warmup.Options{
+		Policy:    warmup.Policy(cfg.CacheWarmupPolicy),
+		Limit:     cfg.CacheWarmupLimit,
+		Window:    cfg.CacheWarmupWindow,
+		BatchSize: cfg.CacheRestoreBatchSize,
+	})
+
+	// Shared order ingestion pipeline for Kafka and HTTP
+	ingestService := ingest.NewService(dbClient, orderCache, ingest.Options{
+		IdempotencyKey: ingest.KeyStrategy(cfg.IngestIdempotencyKey),
+		Strict:         cfg.IngestStrict,
+		Rules:          ruleEngine,
+	})
+
+	// Publishing of OrderStored events from the outbox
+	outboxWriter := outbox.NewKafkaWriter(cfg.KafkaBrokers, cfg.KafkaOutboxTopic)
+	relay := outbox.NewRelay(dbClient, outboxWriter, outbox.Options{
+		Topic:     cfg.KafkaOutboxTopic,
+		BatchSize: cfg.OutboxBatchSize,
+		Interval:  cfg.OutboxPollInterval,
+	})
+
+	// DLQ browsing and replay through the admin API
+	dlq := kafka.NewDLQ(cfg)
+
+	httpServer := server.NewServer(cfg.HTTPPort, orderCache, dbClient, ingestService, healthChecks, server.Admin{
+		Token: cfg.AdminToken,
+		DLQ:   dlq,
+	})
+
+	restart := retry.Policy{
+		MaxAttempts:  cfg.ComponentMaxRestarts + 1,
+		InitialDelay: cfg.ComponentRestartBackoff,
+		MaxDelay:     maxRestartDelay,
+		Jitter:       0.2,
+	}
+	onDB := []string{"db"}
+
+	// Components are stopped in reverse order: order intake (HTTP, Kafka) first,
+	// finishing in-flight work, then background jobs, and only then the
+	// connections they use.
+	sup := NewSupervisor(healthChecks, cfg.ShutdownTimeout)
+	sup.Add("db", NewDatabase(dbClient, cfg.DBAutoMigrate), Options{})
+	sup.Add("dlq", NewResource(dlq.Close), Options{})
+	sup.Add("cache_warmup", NewLoop(warmer.Run, warmer, nil), Options{DependsOn: onDB})
+	if cfg.IdempotencyRetention > 0 {
+		sup.Add("idempotency_purge", NewPurger("processed_messages", cfg.IdempotencyRetention, dbClient.PurgeProcessedMessages), Options{DependsOn: onDB})
+	}
+	sup.Add("outbox_relay", NewLoop(relay.Run, relay, outboxWriter.Close), Options{DependsOn: onDB, Restart: restart})
+	if cfg.OutboxRetention > 0 {
+		sup.Add("outbox_purge", NewPurger("outbox", cfg.OutboxRetention, dbClient.PurgeOutbox), Options{DependsOn: onDB})
+	}
+	sup.Add("kafka_consumer", NewConsumer(func() MessageConsumer {
+		return kafka.NewConsumer(cfg, ingestService)
+	}), Options{DependsOn: onDB, Restart: restart})
+	sup.Add("http", NewHTTPServer(httpServer), Options{DependsOn: []string{"db", "dlq"}, Restart: restart})
+	return sup.Run(ctx)
+}
+
+// NewRuleEngine creates the engine of builtin business rules with severities from INGEST_RULES.
+func NewRuleEngine(cfg *config.Config) (*rules.Engine, error) {
+	overrides, err := rules.ParseOverrides(cfg.IngestRules)
+	if err != nil {
+		return nil, err
+	}
+	engine, err := rules.NewEngine(rules.Builtin(), overrides)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Бизнес-правила: %v", engine.Active())
+	return engine, nil
+}
+
+// ConnectDB connects to the database configured in cfg.
+func ConnectDB(cfg *config.Config) (*db.DBClient, error) {
+	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPassword, cfg.DBName)
+	return db.NewDBClient(connStr)
+}
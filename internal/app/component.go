@@ -0,0 +1,41 @@
+// Package app runs the service as a set of supervised components: it starts
+// them in dependency order, restarts crashed ones with backoff and stops them
+// in reverse order on shutdown.
+package app
+
+import (
+	"context"
+
+	"github.com/112Alex/demo-service.git/internal/health"
+	"github.com/112Alex/demo-service.git/internal/retry"
+)
+
+// Component is a part of the service managed by the Supervisor.
+type Component interface {
+	// Start runs the component and blocks until it is stopped or fails.
+	// It returns nil once stopped or when the component has finished its work;
+	// an error or a panic means the component crashed.
+	Start(ctx context.Context) error
+	// Stop stops the component gracefully, finishing in-flight work until ctx is done.
+	// Start must return soon after Stop; the context of Start is cancelled once Stop returns.
+	Stop(ctx context.Context) error
+	// Health reports the state of the running component.
+	Health() health.Report
+}
+
+// Readier is implemented by components that need time to become usable after
+// Start is called, e.g. to apply migrations. Dependents are started once Ready
+// is closed; other components are ready as soon as Start is called.
+type Readier interface {
+	Ready() <-chan struct{}
+}
+
+// Options configure how a component is supervised.
+type Options struct {
+	// DependsOn names components started before this one and stopped after it.
+	DependsOn []string
+	// Restart is the backoff for restarting the component after a crash.
+	// MaxAttempts counts consecutive runs including the first one; with
+	// MaxAttempts <= 1 a crash is fatal and shuts the service down.
+	Restart retry.Policy
+}
@@ -0,0 +1,227 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/db"
+	"github.com/112Alex/demo-service.git/internal/health"
+	"github.com/112Alex/demo-service.git/internal/server"
+)
+
+// upReport is the health of components without checks of their own.
+var upReport = health.Report{Status: health.StatusUp}
+
+// dbPingTimeout bounds the database check of /health.
+const dbPingTimeout = time.Second
+
+// Database applies migrations on start and closes the connection pool on stop.
+type Database struct {
+	client  *db.DBClient
+	migrate bool
+	ready   chan struct{}
+}
+
+// NewDatabase creates the database component. With migrate, pending
+// migrations are applied before dependents are started.
+func NewDatabase(client *db.DBClient, migrate bool) *Database {
+	return &Database{client: client, migrate: migrate, ready: make(chan struct{})}
+}
+
+// Start implements Component.
+func (d *Database) Start(ctx context.Context) error {
+	if d.migrate {
+		applied, err := d.client.MigrateUp(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("Миграции применены: %d новых", applied)
+	}
+	select {
+	case <-d.ready:
+	default:
+		close(d.ready)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// Ready implements Readier.
+func (d *Database) Ready() <-chan struct{} { return d.ready }
+
+// Stop implements Component.
+func (d *Database) Stop(ctx context.Context) error {
+	return d.client.Close()
+}
+
+// Health implements Component.
+func (d *Database) Health() health.Report {
+	ctx, cancel := context.WithTimeout(context.Background(), dbPingTimeout)
+	defer cancel()
+	if err := d.client.Ping(ctx); err != nil {
+		return health.Report{Status: health.StatusDown, Details: map[string]interface{}{"error": err.Error()}}
+	}
+	return upReport
+}
+
+// Loop runs a function until it returns or the component is stopped,
+// e.g. the outbox relay or the cache warmer.
+type Loop struct {
+	run    func(ctx context.Context)
+	health health.Checker
+	close  func() error
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewLoop creates a component running run. Stop cancels the context of run,
+// waits for it to return and then calls close, if not nil. checker may be nil.
+func NewLoop(run func(ctx context.Context), checker health.Checker, close func() error) *Loop {
+	return &Loop{run: run, health: checker, close: close}
+}
+
+// Start implements Component.
+func (l *Loop) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	l.mu.Lock()
+	l.cancel, l.done = cancel, done
+	l.mu.Unlock()
+	defer close(done)
+	defer cancel()
+	l.run(ctx)
+	return nil
+}
+
+// Stop implements Component.
+func (l *Loop) Stop(ctx context.Context) error {
+	l.mu.Lock()
+	cancel, done := l.cancel, l.done
+	l.mu.Unlock()
+
+	var err error
+	if cancel != nil {
+		cancel()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	if l.close != nil {
+		err = errors.Join(err, l.close())
+	}
+	return err
+}
+
+// Health implements Component.
+func (l *Loop) Health() health.Report {
+	if l.health == nil {
+		return upReport
+	}
+	return l.health.Health()
+}
+
+// NewResource creates a component that only holds a resource, e.g. a Kafka
+// producer, and releases it with close on stop.
+func NewResource(close func() error) *Loop {
+	return NewLoop(func(ctx context.Context) { <-ctx.Done() }, nil, close)
+}
+
+// MessageConsumer is implemented by *kafka.Consumer.
+type MessageConsumer interface {
+	// StartConsumption consumes messages until Shutdown is called or ctx is cancelled;
+	// an error means the consumer crashed.
+	StartConsumption(ctx context.Context) error
+	Shutdown(ctx context.Context) error
+	Health() health.Report
+}
+
+// Consumer runs a Kafka consumer. A consumer cannot be reused after it stops,
+// so every start, including restarts after a crash, creates a new one.
+type Consumer struct {
+	newConsumer func() MessageConsumer
+
+	mu       sync.Mutex
+	current  MessageConsumer
+	stopping bool
+}
+
+// NewConsumer creates the consumer component.
+func NewConsumer(newConsumer func() MessageConsumer) *Consumer {
+	return &Consumer{newConsumer: newConsumer}
+}
+
+// Start implements Component.
+func (c *Consumer) Start(ctx context.Context) error {
+	consumer := c.newConsumer()
+	c.mu.Lock()
+	c.current = consumer
+	c.mu.Unlock()
+	if err := consumer.StartConsumption(ctx); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	stopping := c.stopping
+	c.mu.Unlock()
+	if !stopping && ctx.Err() == nil {
+		return errors.New("потребитель Kafka остановился")
+	}
+	return nil
+}
+
+// Stop implements Component: the consumer drains, see kafka.Consumer.Shutdown.
+func (c *Consumer) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	consumer := c.current
+	c.stopping = true
+	c.mu.Unlock()
+	if consumer == nil {
+		return nil
+	}
+	return consumer.Shutdown(ctx)
+}
+
+// Health implements Component.
+func (c *Consumer) Health() health.Report {
+	c.mu.Lock()
+	consumer := c.current
+	c.mu.Unlock()
+	if consumer == nil {
+		return health.Report{Status: health.StatusDown}
+	}
+	return consumer.Health()
+}
+
+// HTTPServer serves the HTTP API.
+type HTTPServer struct {
+	srv *server.Server
+}
+
+// NewHTTPServer creates the HTTP server component.
+func NewHTTPServer(srv *server.Server) *HTTPServer {
+	return &HTTPServer{srv: srv}
+}
+
+// Start implements Component.
+func (h *HTTPServer) Start(ctx context.Context) error {
+	if err := h.srv.Start(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Stop implements Component: in-flight requests are finished.
+func (h *HTTPServer) Stop(ctx context.Context) error {
+	return h.srv.Shutdown(ctx)
+}
+
+// Health implements Component.
+func (h *HTTPServer) Health() health.Report { return upReport }
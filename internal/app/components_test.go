@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/health"
+	"github.com/112Alex/demo-service.git/internal/retry"
+)
+
+// fakeConsumer consumes until Shutdown or crashes right away with crash.
+type fakeConsumer struct {
+	crash    error
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (f *fakeConsumer) StartConsumption(ctx context.Context) error {
+	if f.crash != nil {
+		return f.crash
+	}
+	select {
+	case <-f.stop:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+func (f *fakeConsumer) Shutdown(ctx context.Context) error {
+	f.stopOnce.Do(func() { close(f.stop) })
+	return nil
+}
+
+func (f *fakeConsumer) Health() health.Report { return upReport }
+
+func TestConsumer_RestartedAfterCrash(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		consumers []*fakeConsumer
+	)
+	component := NewConsumer(func() MessageConsumer {
+		mu.Lock()
+		defer mu.Unlock()
+		c := &fakeConsumer{stop: make(chan struct{})}
+		if len(consumers) == 0 {
+			c.crash = errors.New("паника в обработчике сообщений: nil pointer")
+		}
+		consumers = append(consumers, c)
+		return c
+	})
+	created := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(consumers)
+	}
+
+	checks := health.NewRegistry()
+	s := NewSupervisor(checks, time.Second)
+	s.Add("kafka_consumer", component, Options{Restart: retry.Policy{MaxAttempts: 2, InitialDelay: time.Millisecond}})
+	cancel, done := runSupervisor(s)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for created() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("crashed consumer was not restarted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("expected clean shutdown, got %v", err)
+	}
+
+	select {
+	case <-consumers[1].stop:
+	default:
+		t.Error("expected the restarted consumer to be shut down")
+	}
+	if got := s.byName["kafka_consumer"].restarts; got != 1 {
+		t.Errorf("expected 1 restart, got %d", got)
+	}
+}
+
+func TestConsumer_StoppedOnItsOwnIsCrash(t *testing.T) {
+	component := NewConsumer(func() MessageConsumer {
+		c := &fakeConsumer{stop: make(chan struct{})}
+		close(c.stop)
+		return c
+	})
+	if err := component.Start(context.Background()); err == nil {
+		t.Error("expected a consumer returning without Stop to be reported as a crash")
+	}
+}
@@ -0,0 +1,35 @@
+package app
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/retry"
+)
+
+// purgeInterval is how often a Purger deletes expired rows.
+const purgeInterval = 10 * time.Minute
+
+// PurgeFunc deletes rows older than before and returns their number.
+type PurgeFunc func(ctx context.Context, before time.Time) (int64, error)
+
+// NewPurger creates a component deleting rows older than retention with purge
+// every purgeInterval. what names the rows in the log. Errors are logged and the
+// purge is tried again on the next tick, so the component never fails.
+func NewPurger(what string, retention time.Duration, purge PurgeFunc) *Loop {
+	return NewLoop(func(ctx context.Context) {
+		for {
+			if n, err := purge(ctx, time.Now().Add(-retention)); err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Ошибка очистки (%s): %v", what, err)
+				}
+			} else if n > 0 {
+				log.Printf("Удалено устаревших записей (%s): %d", what, n)
+			}
+			if retry.Sleep(ctx, purgeInterval) != nil {
+				return
+			}
+		}
+	}, nil, nil)
+}
@@ -0,0 +1,304 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/health"
+	"github.com/112Alex/demo-service.git/internal/retry"
+)
+
+// State is the supervision state of a component.
+type State string
+
+const (
+	StateIdle       State = "idle"       // not started yet
+	StateRunning    State = "running"    // started
+	StateRestarting State = "restarting" // crashed, waiting to be restarted
+	StateFinished   State = "finished"   // finished its work
+	StateStopped    State = "stopped"    // stopped on shutdown
+	StateFailed     State = "failed"     // crashed and will not be restarted
+)
+
+// stableRun is how long a component must run after a restart for its
+// consecutive crash count to be reset.
+const stableRun = time.Minute
+
+// Supervisor starts components in dependency order, restarts crashed ones and
+// stops them in reverse order. Component health is reported to a health.Registry
+// under the component name.
+type Supervisor struct {
+	checks      *health.Registry
+	stopTimeout time.Duration
+
+	units  []*unit
+	byName map[string]*unit
+	fatal  chan error // crashes of components that are not restarted
+}
+
+// NewSupervisor creates a supervisor. stopTimeout bounds the whole shutdown.
+func NewSupervisor(checks *health.Registry, stopTimeout time.Duration) *Supervisor {
+	return &Supervisor{
+		checks:      checks,
+		stopTimeout: stopTimeout,
+		byName:      make(map[string]*unit),
+		fatal:       make(chan error, 1),
+	}
+}
+
+// Add registers a component. Components must be added before Run.
+func (s *Supervisor) Add(name string, c Component, opts Options) {
+	u := &unit{name: name, comp: c, opts: opts, state: StateIdle, started: make(chan struct{}), done: make(chan struct{})}
+	s.units = append(s.units, u)
+	s.byName[name] = u
+	s.checks.Register(name, u)
+}
+
+// Run starts all components and blocks until ctx is cancelled or a component
+// crashes for good, then stops the started components in reverse order.
+// It returns nil only for a clean shutdown after ctx is cancelled.
+func (s *Supervisor) Run(ctx context.Context) error {
+	order, err := s.startOrder()
+	if err != nil {
+		return err
+	}
+
+	var started []*unit
+	var runErr error
+	for _, u := range order {
+		log.Printf("Запуск компонента %s...", u.name)
+		s.start(u)
+		started = append(started, u)
+		if runErr = s.awaitReady(ctx, u); runErr != nil {
+			break
+		}
+	}
+	if runErr == nil {
+		log.Println("Все компоненты запущены")
+		select {
+		case <-ctx.Done():
+		case runErr = <-s.fatal:
+		}
+	}
+	if errors.Is(runErr, context.Canceled) && ctx.Err() != nil {
+		runErr = nil // shutdown requested during startup
+	}
+
+	log.Println("Остановка компонентов...")
+	stopCtx, cancel := context.WithTimeout(context.Background(), s.stopTimeout)
+	defer cancel()
+	errs := []error{runErr}
+	for i := len(started) - 1; i >= 0; i-- {
+		if err := started[i].stop(stopCtx); err != nil {
+			errs = append(errs, fmt.Errorf("остановка компонента %s: %w", started[i].name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// startOrder sorts the components so that each follows its dependencies,
+// keeping the order of Add otherwise.
+func (s *Supervisor) startOrder() ([]*unit, error) {
+	for _, u := range s.units {
+		for _, dep := range u.opts.DependsOn {
+			if _, ok := s.byName[dep]; !ok {
+				return nil, fmt.Errorf("компонент %s зависит от неизвестного компонента %s", u.name, dep)
+			}
+		}
+	}
+
+	order := make([]*unit, 0, len(s.units))
+	placed := make(map[string]bool, len(s.units))
+	for len(order) < len(s.units) {
+		progress := false
+		for _, u := range s.units {
+			if placed[u.name] || !u.depsPlaced(placed) {
+				continue
+			}
+			order = append(order, u)
+			placed[u.name] = true
+			progress = true
+		}
+		if !progress {
+			return nil, errors.New("циклическая зависимость между компонентами")
+		}
+	}
+	return order, nil
+}
+
+// start launches the supervision loop of a component.
+func (s *Supervisor) start(u *unit) {
+	u.ctx, u.cancel = context.WithCancel(context.Background())
+	go func() {
+		defer close(u.done)
+		if err := u.supervise(); err != nil {
+			select {
+			case s.fatal <- err:
+			default: // shutdown is already under way
+			}
+		}
+	}()
+}
+
+// awaitReady waits until the component is ready, it crashes or ctx is cancelled.
+func (s *Supervisor) awaitReady(ctx context.Context, u *unit) error {
+	var ready <-chan struct{} = u.started
+	if r, ok := u.comp.(Readier); ok {
+		ready = r.Ready()
+	}
+	select {
+	case <-ready:
+		return nil
+	case err := <-s.fatal:
+		return err
+	case <-u.done:
+		return fmt.Errorf("компонент %s завершился, не став готовым", u.name)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// unit is a supervised component.
+type unit struct {
+	name string
+	comp Component
+	opts Options
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started chan struct{} // closed when Start is about to be called for the first time
+	done    chan struct{} // closed when the supervision loop exits
+
+	mu       sync.Mutex
+	state    State
+	stopping bool
+	restarts int
+	lastErr  error
+}
+
+func (u *unit) depsPlaced(placed map[string]bool) bool {
+	for _, dep := range u.opts.DependsOn {
+		if !placed[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+// supervise runs the component, restarting it after crashes according to the
+// restart policy. It returns an error when the component crashed for good.
+func (u *unit) supervise() error {
+	failures := 0
+	for {
+		if !u.begin() {
+			return nil
+		}
+		startedAt := time.Now()
+		err := u.run()
+
+		u.mu.Lock()
+		stopping := u.stopping
+		u.mu.Unlock()
+		switch {
+		case stopping:
+			u.setState(StateStopped, nil)
+			return nil
+		case err == nil:
+			log.Printf("Компонент %s завершил работу", u.name)
+			u.setState(StateFinished, nil)
+			return nil
+		}
+
+		if time.Since(startedAt) >= stableRun {
+			failures = 0
+		}
+		failures++
+		if failures >= u.opts.Restart.MaxAttempts {
+			log.Printf("Компонент %s аварийно завершился: %v", u.name, err)
+			u.setState(StateFailed, err)
+			return fmt.Errorf("компонент %s аварийно завершился: %w", u.name, err)
+		}
+
+		delay := u.opts.Restart.Delay(failures)
+		log.Printf("Компонент %s аварийно завершился, перезапуск через %s (попытка %d/%d): %v",
+			u.name, delay, failures+1, u.opts.Restart.MaxAttempts, err)
+		u.setState(StateRestarting, err)
+		if retry.Sleep(u.ctx, delay) != nil {
+			u.setState(StateStopped, nil)
+			return nil
+		}
+		u.mu.Lock()
+		u.restarts++
+		u.mu.Unlock()
+	}
+}
+
+// begin marks the component as running unless it is being stopped.
+func (u *unit) begin() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.stopping {
+		return false
+	}
+	if u.state == StateIdle {
+		close(u.started)
+	}
+	u.state = StateRunning
+	return true
+}
+
+// run calls Start, turning a panic into an error.
+func (u *unit) run() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("паника: %v", r)
+		}
+	}()
+	return u.comp.Start(u.ctx)
+}
+
+// stop stops the component and waits for its supervision loop to exit.
+func (u *unit) stop(ctx context.Context) error {
+	u.mu.Lock()
+	u.stopping = true
+	u.mu.Unlock()
+
+	log.Printf("Остановка компонента %s...", u.name)
+	err := u.comp.Stop(ctx)
+	u.cancel()
+	select {
+	case <-u.done:
+	case <-ctx.Done():
+		err = errors.Join(err, fmt.Errorf("не остановился вовремя: %w", ctx.Err()))
+	}
+	return err
+}
+
+func (u *unit) setState(state State, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.state = state
+	if err != nil {
+		u.lastErr = err
+	}
+}
+
+// Health reports the component health while it runs and its supervision state otherwise.
+func (u *unit) Health() health.Report {
+	u.mu.Lock()
+	state, restarts, lastErr := u.state, u.restarts, u.lastErr
+	u.mu.Unlock()
+
+	if state == StateRunning || state == StateFinished {
+		return u.comp.Health()
+	}
+	details := map[string]interface{}{"state": state, "restarts": restarts}
+	if lastErr != nil {
+		details["last_error"] = lastErr.Error()
+	}
+	return health.Report{Status: health.StatusDown, Details: details}
+}
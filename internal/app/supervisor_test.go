@@ -0,0 +1,218 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/health"
+	"github.com/112Alex/demo-service.git/internal/retry"
+)
+
+// eventLog records starts and stops of fake components in order.
+type eventLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *eventLog) add(e string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+func (l *eventLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.events...)
+}
+
+// waitFor polls until the log has n events.
+func (l *eventLog) waitFor(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(l.get()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d events, got %v", n, l.get())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// fakeComponent runs until its context is cancelled. crash, if set, is called
+// on every start and may fail the run by returning an error or panicking.
+type fakeComponent struct {
+	name  string
+	log   *eventLog
+	crash func(run int) error
+
+	mu   sync.Mutex
+	runs int
+}
+
+func (f *fakeComponent) Start(ctx context.Context) error {
+	f.mu.Lock()
+	f.runs++
+	run := f.runs
+	f.mu.Unlock()
+
+	f.log.add("start:" + f.name)
+	if f.crash != nil {
+		if err := f.crash(run); err != nil {
+			return err
+		}
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func (f *fakeComponent) Stop(ctx context.Context) error {
+	f.log.add("stop:" + f.name)
+	return nil
+}
+
+func (f *fakeComponent) Health() health.Report { return upReport }
+
+// readyComponent becomes ready when ready is closed.
+type readyComponent struct {
+	*fakeComponent
+	ready chan struct{}
+}
+
+func (r *readyComponent) Ready() <-chan struct{} { return r.ready }
+
+func runSupervisor(s *Supervisor) (context.CancelFunc, <-chan error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	return cancel, done
+}
+
+func TestSupervisor_DependencyOrder(t *testing.T) {
+	log := &eventLog{}
+	s := NewSupervisor(health.NewRegistry(), time.Second)
+	s.Add("http", &fakeComponent{name: "http", log: log}, Options{DependsOn: []string{"db", "dlq"}})
+	s.Add("db", &fakeComponent{name: "db", log: log}, Options{})
+	s.Add("dlq", &fakeComponent{name: "dlq", log: log}, Options{})
+
+	cancel, done := runSupervisor(s)
+	log.waitFor(t, 3)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("expected clean shutdown, got %v", err)
+	}
+
+	want := []string{"start:db", "start:dlq", "start:http", "stop:http", "stop:dlq", "stop:db"}
+	if got := log.get(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestSupervisor_WaitsForReadiness(t *testing.T) {
+	log := &eventLog{}
+	db := &readyComponent{fakeComponent: &fakeComponent{name: "db", log: log}, ready: make(chan struct{})}
+	s := NewSupervisor(health.NewRegistry(), time.Second)
+	s.Add("db", db, Options{})
+	s.Add("http", &fakeComponent{name: "http", log: log}, Options{DependsOn: []string{"db"}})
+
+	cancel, done := runSupervisor(s)
+	defer func() {
+		cancel()
+		<-done
+	}()
+	log.waitFor(t, 1)
+	time.Sleep(20 * time.Millisecond)
+	if got := log.get(); len(got) != 1 {
+		t.Fatalf("expected http to wait for db readiness, got %v", got)
+	}
+	close(db.ready)
+	log.waitFor(t, 2)
+}
+
+func TestSupervisor_RestartsCrashedComponent(t *testing.T) {
+	log := &eventLog{}
+	checks := health.NewRegistry()
+	consumer := &fakeComponent{name: "consumer", log: log, crash: func(run int) error {
+		switch run {
+		case 1:
+			return errors.New("broker unavailable")
+		case 2:
+			panic("nil map")
+		}
+		return nil
+	}}
+	s := NewSupervisor(checks, time.Second)
+	s.Add("consumer", consumer, Options{Restart: retry.Policy{MaxAttempts: 3, InitialDelay: time.Millisecond}})
+
+	cancel, done := runSupervisor(s)
+	log.waitFor(t, 3)
+	if _, reports := checks.Check(); reports["consumer"].Status != health.StatusUp {
+		t.Errorf("expected restarted consumer to be up, got %+v", reports["consumer"])
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("expected clean shutdown, got %v", err)
+	}
+	if got := s.byName["consumer"].restarts; got != 2 {
+		t.Errorf("expected 2 restarts, got %d", got)
+	}
+}
+
+func TestSupervisor_CrashIsFatal(t *testing.T) {
+	tests := []struct {
+		name    string
+		restart retry.Policy
+	}{
+		{"no restart policy", retry.Policy{}},
+		{"restarts exhausted", retry.Policy{MaxAttempts: 2, InitialDelay: time.Millisecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &eventLog{}
+			checks := health.NewRegistry()
+			s := NewSupervisor(checks, time.Second)
+			s.Add("db", &fakeComponent{name: "db", log: log}, Options{})
+			s.Add("relay", &fakeComponent{name: "relay", log: log, crash: func(int) error {
+				return errors.New("boom")
+			}}, Options{DependsOn: []string{"db"}, Restart: tt.restart})
+
+			_, done := runSupervisor(s)
+			select {
+			case err := <-done:
+				if err == nil {
+					t.Fatal("expected the crash to be returned")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("supervisor did not shut down after a fatal crash")
+			}
+			if got := log.get(); got[len(got)-1] != "stop:db" {
+				t.Errorf("expected db to be stopped last, got %v", got)
+			}
+			if _, reports := checks.Check(); reports["relay"].Status != health.StatusDown {
+				t.Errorf("expected failed relay to be down, got %+v", reports["relay"])
+			}
+		})
+	}
+}
+
+func TestSupervisor_InvalidDependencies(t *testing.T) {
+	log := &eventLog{}
+	s := NewSupervisor(health.NewRegistry(), time.Second)
+	s.Add("http", &fakeComponent{name: "http", log: log}, Options{DependsOn: []string{"db"}})
+	if err := s.Run(context.Background()); err == nil {
+		t.Error("expected an error for an unknown dependency")
+	}
+
+	s = NewSupervisor(health.NewRegistry(), time.Second)
+	s.Add("a", &fakeComponent{name: "a", log: log}, Options{DependsOn: []string{"b"}})
+	s.Add("b", &fakeComponent{name: "b", log: log}, Options{DependsOn: []string{"a"}})
+	if err := s.Run(context.Background()); err == nil {
+		t.Error("expected an error for a dependency cycle")
+	}
+	if got := log.get(); len(got) != 0 {
+		t.Errorf("expected nothing to be started, got %v", got)
+	}
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
     "container/list"
+    "sort"
     "sync"
     "time"
 
@@ -26,6 +27,9 @@ type Cache struct {
 
     items map[string]*entry // fast key lookup
     lru   *list.List        // doubly-linked list of *entry; most-recent at front
+
+    byTrack    *secondaryIndex // track_number -> cached order UIDs
+    byCustomer *secondaryIndex // customer_id -> cached order UIDs
 }
 
 // NewCache returns a cache with the given capacity and TTL. A zero TTL disables time-based eviction.
@@ -38,6 +42,9 @@ func NewCache(capacity int, ttl time.Duration) *Cache {
         ttl:      ttl,
         items:    make(map[string]*entry, capacity),
         lru:      list.New(),
+
+        byTrack:    newSecondaryIndex(func(o *model.Order) string { return o.TrackNumber }),
+        byCustomer: newSecondaryIndex(func(o *model.Order) string { return o.CustomerID }),
     }
 }
 
@@ -47,8 +54,32 @@ func (c *Cache) Set(orderUID string, order *model.Order) {
     c.mu.Lock()
     defer c.mu.Unlock()
 
+    c.setLocked(orderUID, order)
+}
+
+// SetIfAbsent adds an order only if it is not cached yet and reports whether it was added.
+// Used by background loaders so they never overwrite a fresher value written concurrently.
+// The order is added as the least recently used one, so orders loaded most important first
+// keep that priority and never evict orders used since; a full cache takes no more of them.
+func (c *Cache) SetIfAbsent(orderUID string, order *model.Order) bool {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if _, ok := c.items[orderUID]; ok || len(c.items) >= c.capacity {
+        return false
+    }
+    e := &entry{key: orderUID, value: order, timestamp: time.Now()}
+    e.element = c.lru.PushBack(e)
+    c.items[orderUID] = e
+    c.index(e)
+    return true
+}
+
+// setLocked implements Set. Caller must hold write lock.
+func (c *Cache) setLocked(orderUID string, order *model.Order) {
     // Update existing item if present
     if e, ok := c.items[orderUID]; ok {
+        c.reindex(e, order)
         e.value = order
         e.timestamp = time.Now()
         c.lru.MoveToFront(e.element)
@@ -59,6 +90,7 @@ func (c *Cache) Set(orderUID string, order *model.Order) {
     e := &entry{key: orderUID, value: order, timestamp: time.Now()}
     e.element = c.lru.PushFront(e)
     c.items[orderUID] = e
+    c.index(e)
 
     // Evict if over capacity
     if len(c.items) > c.capacity {
@@ -92,6 +124,95 @@ func (c *Cache) Get(orderUID string) (*model.Order, bool) {
     return e.value, true
 }
 
+// GetByTrackNumber returns all orders with the given track number if the
+// complete result set is cached (see SetByTrackNumber).
+func (c *Cache) GetByTrackNumber(trackNumber string) ([]*model.Order, bool) {
+    return c.lookup(c.byTrack, trackNumber)
+}
+
+// SetByTrackNumber caches the full database result for a track number lookup.
+func (c *Cache) SetByTrackNumber(trackNumber string, orders []*model.Order) {
+    c.store(c.byTrack, trackNumber, orders)
+}
+
+// GetByCustomerID returns all orders of the customer if the complete result
+// set is cached (see SetByCustomerID).
+func (c *Cache) GetByCustomerID(customerID string) ([]*model.Order, bool) {
+    return c.lookup(c.byCustomer, customerID)
+}
+
+// SetByCustomerID caches the full database result for a customer lookup.
+func (c *Cache) SetByCustomerID(customerID string, orders []*model.Order) {
+    c.store(c.byCustomer, customerID, orders)
+}
+
+// lookup serves a secondary key query from a complete index set.
+// Orders are returned newest first, like the database queries.
+func (c *Cache) lookup(ix *secondaryIndex, key string) ([]*model.Order, bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    now := time.Now()
+    uids, ok := ix.lookup(key, now)
+    if !ok {
+        return nil, false
+    }
+
+    orders := make([]*model.Order, 0, len(uids))
+    for _, uid := range uids {
+        e := c.items[uid]
+        if c.ttl > 0 && now.Sub(e.timestamp) > c.ttl {
+            c.removeElement(e) // marks the set incomplete
+            return nil, false
+        }
+        c.lru.MoveToFront(e.element)
+        orders = append(orders, e.value)
+    }
+
+    sort.Slice(orders, func(i, j int) bool {
+        if !orders[i].DateCreated.Equal(orders[j].DateCreated) {
+            return orders[i].DateCreated.After(orders[j].DateCreated)
+        }
+        return orders[i].OrderUID > orders[j].OrderUID
+    })
+    return orders, true
+}
+
+// store caches orders and marks the index set for key as complete for the cache TTL.
+// Other replicas may add orders with the same key, so without a TTL the result
+// is never treated as complete and only the orders themselves are cached.
+// Empty results are cached too, so unknown keys do not hit the database on every
+// request; at most capacity of them are kept per index.
+func (c *Cache) store(ix *secondaryIndex, key string, orders []*model.Order) {
+    if key == "" {
+        return
+    }
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.ttl <= 0 {
+        for _, o := range orders {
+            c.setLocked(o.OrderUID, o)
+        }
+        return
+    }
+
+    if len(orders) == 0 {
+        ix.resetEmpty(key, time.Now().Add(c.ttl), c.capacity)
+        return
+    }
+
+    // Reset first: evictions triggered by the inserts below must be able to
+    // mark the set incomplete again.
+    ix.reset(key, time.Now().Add(c.ttl))
+    for _, o := range orders {
+        c.setLocked(o.OrderUID, o)
+        // setLocked does not reindex an already cached order whose key is unchanged
+        ix.add(key, o.OrderUID)
+    }
+}
+
 // GetAll returns a shallow copy of all cached orders. Expired items are skipped.
 func (c *Cache) GetAll() map[string]*model.Order {
     now := time.Now()
@@ -121,4 +242,31 @@ func (c *Cache) evictOldest() {
 func (c *Cache) removeElement(e *entry) {
     c.lru.Remove(e.element)
     delete(c.items, e.key)
+    c.unindex(e, true)
+}
+
+// index adds an entry to secondary indexes. Caller must hold write lock.
+func (c *Cache) index(e *entry) {
+    for _, ix := range []*secondaryIndex{c.byTrack, c.byCustomer} {
+        ix.add(ix.keyOf(e.value), e.key)
+    }
+}
+
+// reindex moves an entry between index sets when the new order value changes
+// its secondary keys. Caller must hold write lock.
+func (c *Cache) reindex(e *entry, order *model.Order) {
+    for _, ix := range []*secondaryIndex{c.byTrack, c.byCustomer} {
+        oldKey, newKey := ix.keyOf(e.value), ix.keyOf(order)
+        if oldKey != newKey {
+            ix.remove(oldKey, e.key, false)
+            ix.add(newKey, e.key)
+        }
+    }
+}
+
+// unindex removes an entry from secondary indexes. Caller must hold write lock.
+func (c *Cache) unindex(e *entry, evicted bool) {
+    for _, ix := range []*secondaryIndex{c.byTrack, c.byCustomer} {
+        ix.remove(ix.keyOf(e.value), e.key, evicted)
+    }
 }
@@ -102,4 +102,158 @@ func mustGet(t *testing.T, c *Cache, uid string) *model.Order {
         t.Fatalf("uid %s not found", uid)
     }
     return v
-}
\ No newline at end of file
+}
+
+func TestCache_TrackNumberIndex(t *testing.T) {
+    c := NewCache(10, time.Minute)
+    if _, ok := c.GetByTrackNumber("TRACK"); ok {
+        t.Fatal("unexpected hit for unknown track number")
+    }
+
+    o1 := &model.Order{OrderUID: "1", TrackNumber: "TRACK", DateCreated: time.Unix(100, 0)}
+    o2 := &model.Order{OrderUID: "2", TrackNumber: "TRACK", DateCreated: time.Unix(200, 0)}
+    c.SetByTrackNumber("TRACK", []*model.Order{o1, o2})
+
+    got, ok := c.GetByTrackNumber("TRACK")
+    if !ok || len(got) != 2 {
+        t.Fatalf("expected 2 cached orders, got %d (hit=%v)", len(got), ok)
+    }
+    if got[0].OrderUID != "2" {
+        t.Errorf("expected newest order first, got %s", got[0].OrderUID)
+    }
+
+    // A new order with the same track number keeps the set complete.
+    c.Set("3", &model.Order{OrderUID: "3", TrackNumber: "TRACK"})
+    if got, ok := c.GetByTrackNumber("TRACK"); !ok || len(got) != 3 {
+        t.Errorf("expected 3 cached orders, got %d (hit=%v)", len(got), ok)
+    }
+
+    // Moving an order to another track removes it from the set.
+    c.Set("3", &model.Order{OrderUID: "3", TrackNumber: "OTHER"})
+    if got, ok := c.GetByTrackNumber("TRACK"); !ok || len(got) != 2 {
+        t.Errorf("expected 2 cached orders, got %d (hit=%v)", len(got), ok)
+    }
+}
+
+func TestCache_CustomerIndexInvalidatedOnEviction(t *testing.T) {
+    c := NewCache(2, time.Minute)
+    o1 := &model.Order{OrderUID: "1", CustomerID: "cust"}
+    o2 := &model.Order{OrderUID: "2", CustomerID: "cust"}
+    c.SetByCustomerID("cust", []*model.Order{o1, o2})
+
+    if _, ok := c.GetByCustomerID("cust"); !ok {
+        t.Fatal("expected customer orders to be cached")
+    }
+
+    c.Set("3", &model.Order{OrderUID: "3", CustomerID: "other"}) // evicts one of the customer's orders
+    if _, ok := c.GetByCustomerID("cust"); ok {
+        t.Error("expected incomplete customer set after eviction")
+    }
+}
+
+func TestCache_IndexIncludesCachedOrders(t *testing.T) {
+    c := NewCache(10, time.Minute)
+    o1 := &model.Order{OrderUID: "1", TrackNumber: "TRACK"}
+    o2 := &model.Order{OrderUID: "2", TrackNumber: "TRACK"}
+    c.Set("1", o1)
+    c.SetByTrackNumber("TRACK", []*model.Order{o1, o2})
+
+    if got, ok := c.GetByTrackNumber("TRACK"); !ok || len(got) != 2 {
+        t.Errorf("expected 2 cached orders, got %d (hit=%v)", len(got), ok)
+    }
+}
+
+func TestCache_IndexExpires(t *testing.T) {
+    c := NewCache(10, 0)
+    c.SetByTrackNumber("TRACK", []*model.Order{{OrderUID: "1", TrackNumber: "TRACK"}})
+    if _, ok := c.GetByTrackNumber("TRACK"); ok {
+        t.Error("expected no index hits without a TTL")
+    }
+    if _, ok := c.Get("1"); !ok {
+        t.Error("expected the order itself to be cached")
+    }
+
+    c = NewCache(10, 20*time.Millisecond)
+    c.SetByTrackNumber("TRACK", []*model.Order{{OrderUID: "1", TrackNumber: "TRACK"}})
+    time.Sleep(10 * time.Millisecond)
+    c.Set("1", &model.Order{OrderUID: "1", TrackNumber: "TRACK"}) // refreshes the order, not the set
+    time.Sleep(15 * time.Millisecond)
+    if _, ok := c.GetByTrackNumber("TRACK"); ok {
+        t.Error("expected the index set to expire after the TTL")
+    }
+}
+
+func TestCache_IndexEmptyResults(t *testing.T) {
+    c := NewCache(2, time.Minute)
+    c.SetByCustomerID("a", nil)
+    if got, ok := c.GetByCustomerID("a"); !ok || len(got) != 0 {
+        t.Fatalf("expected a cached empty result, got %d (hit=%v)", len(got), ok)
+    }
+
+    c.Set("1", &model.Order{OrderUID: "1", CustomerID: "a"}) // written by this replica
+    if got, ok := c.GetByCustomerID("a"); !ok || len(got) != 1 {
+        t.Errorf("expected the new order in the set, got %d (hit=%v)", len(got), ok)
+    }
+
+    c.SetByCustomerID("b", nil)
+    c.SetByCustomerID("c", nil)
+    c.SetByCustomerID("d", nil) // drops "b", the oldest empty result
+    if _, ok := c.GetByCustomerID("b"); ok {
+        t.Error("expected empty results to be bounded by capacity")
+    }
+    for _, key := range []string{"a", "c", "d"} {
+        if _, ok := c.GetByCustomerID(key); !ok {
+            t.Errorf("expected %s to be cached", key)
+        }
+    }
+}
+
+func TestCache_IndexEmptyResultExpires(t *testing.T) {
+    c := NewCache(10, 10*time.Millisecond)
+    c.SetByTrackNumber("TRACK", nil)
+    time.Sleep(15 * time.Millisecond)
+    if _, ok := c.GetByTrackNumber("TRACK"); ok {
+        t.Error("expected the empty result to expire after the TTL")
+    }
+    if _, ok := c.byTrack.sets["TRACK"]; ok {
+        t.Error("expected the expired empty set to be dropped")
+    }
+}
+
+func TestCache_SetIfAbsent(t *testing.T) {
+    c := NewCache(10, 0)
+    fresh := &model.Order{OrderUID: "1", Version: 2}
+    c.Set(fresh.OrderUID, fresh)
+
+    if c.SetIfAbsent("1", &model.Order{OrderUID: "1", Version: 1}) {
+        t.Error("expected existing order to be kept")
+    }
+    if got := mustGet(t, c, "1"); got.Version != 2 {
+        t.Errorf("expected version 2, got %d", got.Version)
+    }
+    if !c.SetIfAbsent("2", &model.Order{OrderUID: "2"}) {
+        t.Error("expected absent order to be added")
+    }
+}
+
+func TestCache_SetIfAbsentAddsLeastRecentlyUsed(t *testing.T) {
+    c := NewCache(3, 0)
+    // Loaded newest first: "new" must outlive "old".
+    c.SetIfAbsent("new", &model.Order{OrderUID: "new"})
+    c.SetIfAbsent("old", &model.Order{OrderUID: "old"})
+    c.Set("live", &model.Order{OrderUID: "live"})
+
+    if c.SetIfAbsent("older", &model.Order{OrderUID: "older"}) {
+        t.Error("expected a full cache to reject loaded orders")
+    }
+    c.Set("next", &model.Order{OrderUID: "next"})
+
+    if _, ok := c.Get("old"); ok {
+        t.Error("expected the oldest loaded order to be evicted first")
+    }
+    for _, uid := range []string{"new", "live", "next"} {
+        if _, ok := c.Get(uid); !ok {
+            t.Errorf("expected %s to be kept", uid)
+        }
+    }
+}
@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/model"
+)
+
+// indexSet holds order UIDs cached under a single secondary key value.
+// complete means the set mirrors the database result for that value, so
+// lookups may be served from the cache without querying Postgres until
+// expires: orders written by other replicas are not observed by this cache.
+type indexSet struct {
+	uids     map[string]struct{}
+	complete bool
+	expires  time.Time
+	empty    *list.Element // position in secondaryIndex.empty while the set has no orders
+}
+
+// secondaryIndex maps a derived order attribute (track number, customer id)
+// to the set of cached orders sharing it. Caller must hold the cache write lock.
+type secondaryIndex struct {
+	keyOf func(*model.Order) string
+	sets  map[string]*indexSet
+	empty *list.List // keys of complete sets without orders, oldest first
+}
+
+func newSecondaryIndex(keyOf func(*model.Order) string) *secondaryIndex {
+	return &secondaryIndex{keyOf: keyOf, sets: make(map[string]*indexSet), empty: list.New()}
+}
+
+// add registers uid under key. A complete set stays complete because the
+// cache observes every write made by this replica.
+func (ix *secondaryIndex) add(key, uid string) {
+	if key == "" {
+		return
+	}
+	s, ok := ix.sets[key]
+	if !ok {
+		s = &indexSet{uids: make(map[string]struct{})}
+		ix.sets[key] = s
+	}
+	if s.empty != nil {
+		ix.empty.Remove(s.empty)
+		s.empty = nil
+	}
+	s.uids[uid] = struct{}{}
+}
+
+// remove drops uid from key. When the order was evicted (it still belongs to
+// key in the database) the set can no longer be trusted as complete.
+func (ix *secondaryIndex) remove(key, uid string, evicted bool) {
+	s, ok := ix.sets[key]
+	if !ok {
+		return
+	}
+	delete(s.uids, uid)
+	if evicted {
+		s.complete = false
+	}
+	if len(s.uids) == 0 {
+		ix.drop(key)
+	}
+}
+
+// reset starts a fresh set for key, complete until expires; orders are added afterwards.
+func (ix *secondaryIndex) reset(key string, expires time.Time) {
+	ix.drop(key)
+	ix.sets[key] = &indexSet{uids: make(map[string]struct{}), complete: true, expires: expires}
+}
+
+// resetEmpty records that key has no orders until expires. Such sets hold no
+// cached orders, so their number is bounded by limit separately: the oldest
+// is dropped first.
+func (ix *secondaryIndex) resetEmpty(key string, expires time.Time, limit int) {
+	ix.drop(key)
+	for ix.empty.Len() > 0 && ix.empty.Len() >= limit {
+		ix.drop(ix.empty.Front().Value.(string))
+	}
+	ix.sets[key] = &indexSet{
+		uids:     make(map[string]struct{}),
+		complete: true,
+		expires:  expires,
+		empty:    ix.empty.PushBack(key),
+	}
+}
+
+// drop deletes the set for key.
+func (ix *secondaryIndex) drop(key string) {
+	if s, ok := ix.sets[key]; ok {
+		if s.empty != nil {
+			ix.empty.Remove(s.empty)
+		}
+		delete(ix.sets, key)
+	}
+}
+
+// lookup returns uids for key if the set is complete and not expired.
+func (ix *secondaryIndex) lookup(key string, now time.Time) ([]string, bool) {
+	s, ok := ix.sets[key]
+	if !ok || !s.complete {
+		return nil, false
+	}
+	if now.After(s.expires) {
+		s.complete = false
+		if len(s.uids) == 0 {
+			ix.drop(key)
+		}
+		return nil, false
+	}
+	uids := make([]string, 0, len(s.uids))
+	for uid := range s.uids {
+		uids = append(uids, uid)
+	}
+	return uids, true
+}
@@ -0,0 +1,35 @@
+package codec
+
+import (
+	"fmt"
+)
+
+// AvroDecoder decodes Avro binary payloads in the Confluent wire format to standard JSON.
+// Avro field names must match the JSON fields of the model; time fields are RFC 3339 strings.
+type AvroDecoder struct {
+	schemas *SchemaRegistry
+}
+
+// Decode implements Decoder.
+func (d *AvroDecoder) Decode(data []byte) ([]byte, error) {
+	id, data, err := splitWire(data)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := d.schemas.Avro(id)
+	if err != nil {
+		return nil, err
+	}
+	native, rest, err := codec.NativeFromBinary(data)
+	if err != nil {
+		return nil, fmt.Errorf("некорректное Avro-сообщение (схема %d): %w", id, err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("некорректное Avro-сообщение (схема %d): лишние %d байт", id, len(rest))
+	}
+	out, err := codec.TextualFromNative(nil, native)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось преобразовать Avro-сообщение (схема %d) в JSON: %w", id, err)
+	}
+	return out, nil
+}
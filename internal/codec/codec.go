@@ -0,0 +1,80 @@
+// Package codec converts binary message payloads (Protobuf, Avro) to the JSON
+// the ingestion pipeline decodes, selected by the message content type.
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+)
+
+// Content types of message payloads. Parameters such as "; charset=utf-8" are ignored.
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeAvro     = "application/avro"
+)
+
+// ErrUnsupportedContentType is returned for a content type without a decoder.
+var ErrUnsupportedContentType = errors.New("неподдерживаемый content-type")
+
+// Decoder converts a payload to JSON. Binary decoders expect the Confluent
+// wire format and resolve the writer schema in a SchemaRegistry.
+type Decoder interface {
+	Decode(data []byte) ([]byte, error)
+}
+
+// Decoders selects a Decoder by content type.
+type Decoders struct {
+	byType map[string]Decoder
+}
+
+// NewDecoders returns decoders for JSON and, if schemas is not nil, for Protobuf and Avro.
+func NewDecoders(schemas *SchemaRegistry) *Decoders {
+	d := &Decoders{byType: map[string]Decoder{
+		ContentTypeJSON: jsonDecoder{},
+	}}
+	if schemas != nil {
+		d.Register(ContentTypeProtobuf, &ProtobufDecoder{schemas: schemas})
+		d.Register("application/protobuf", &ProtobufDecoder{schemas: schemas})
+		d.Register(ContentTypeAvro, &AvroDecoder{schemas: schemas})
+		d.Register("avro/binary", &AvroDecoder{schemas: schemas})
+	}
+	return d
+}
+
+// Register sets the decoder of a content type, replacing the previous one.
+func (d *Decoders) Register(contentType string, dec Decoder) {
+	d.byType[contentType] = dec
+}
+
+// Decode converts data of the given content type to JSON. An empty content type
+// means JSON, so messages of producers unaware of content types are unchanged.
+// A nil *Decoders accepts only JSON.
+func (d *Decoders) Decode(contentType string, data []byte) ([]byte, error) {
+	if contentType == "" {
+		return data, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %w", ErrUnsupportedContentType, contentType, err)
+	}
+	if mediaType == ContentTypeJSON {
+		return data, nil
+	}
+	var dec Decoder
+	if d != nil {
+		dec = d.byType[mediaType]
+	}
+	if dec == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedContentType, mediaType)
+	}
+	return dec.Decode(data)
+}
+
+// jsonDecoder passes JSON payloads through; they are decoded by the model.
+type jsonDecoder struct{}
+
+func (jsonDecoder) Decode(data []byte) ([]byte, error) {
+	return data, nil
+}
@@ -0,0 +1,249 @@
+package codec
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/112Alex/demo-service.git/internal/model"
+)
+
+// wire prepends the Confluent wire-format header to data.
+func wire(id uint32, data ...byte) []byte {
+	out := []byte{wireMagic, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(out[1:], id)
+	return append(out, data...)
+}
+
+func TestDecoders_ContentType(t *testing.T) {
+	payload := []byte(`{"order_uid":"1"}`)
+	d := NewDecoders(nil)
+	for _, ct := range []string{"", ContentTypeJSON, "application/json; charset=utf-8"} {
+		got, err := d.Decode(ct, payload)
+		if err != nil || string(got) != string(payload) {
+			t.Errorf("%q: ожидался исходный JSON, получено %s, %v", ct, got, err)
+		}
+	}
+
+	for _, ct := range []string{ContentTypeAvro, ContentTypeProtobuf, "text/plain", ";"} {
+		if _, err := d.Decode(ct, payload); !errors.Is(err, ErrUnsupportedContentType) {
+			t.Errorf("%q: ожидалась ErrUnsupportedContentType, получено %v", ct, err)
+		}
+	}
+
+	var none *Decoders
+	if _, err := none.Decode(ContentTypeJSON, payload); err != nil {
+		t.Errorf("nil Decoders должен принимать JSON, получено %v", err)
+	}
+}
+
+const orderSchema = `{
+  "type": "record", "name": "Order",
+  "fields": [
+    {"name": "order_uid", "type": "string"},
+    {"name": "locale", "type": ["null", "string"], "default": null},
+    {"name": "date_created", "type": "string"},
+    {"name": "payment", "type": {"type": "record", "name": "Payment", "fields": [
+      {"name": "amount", "type": "long"},
+      {"name": "currency", "type": "string"}
+    ]}},
+    {"name": "items", "type": {"type": "array", "items": {"type": "record", "name": "Item", "fields": [
+      {"name": "chrt_id", "type": "long"},
+      {"name": "name", "type": "string"}
+    ]}}}
+  ]
+}`
+
+func TestAvroDecoder(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "7.avsc"), []byte(orderSchema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	schemas := NewSchemaRegistry(dir)
+	codec, err := schemas.Avro(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	native, _, err := codec.NativeFromTextual([]byte(`{"order_uid":"1","locale":"en","date_created":"2021-11-26T06:22:19Z",
+		"payment":{"amount":1817,"currency":"USD"},"items":[{"chrt_id":9934930,"name":"Mascaras"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin, err := codec.BinaryFromNative(nil, native)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoders(schemas)
+	data, err := d.Decode(ContentTypeAvro, wire(7, bin...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var o model.Order
+	if err := json.Unmarshal(data, &o); err != nil {
+		t.Fatalf("Ожидался JSON заказа, получено %s: %v", data, err)
+	}
+	if o.OrderUID != "1" || o.Locale != "en" || o.Payment.Amount != 1817 || len(o.Items) != 1 || o.Items[0].ChrtID != 9934930 {
+		t.Errorf("Неверно декодирован заказ: %s", data)
+	}
+	if !o.DateCreated.Equal(time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)) {
+		t.Errorf("Неверно декодирована дата: %s", o.DateCreated)
+	}
+
+	if _, err := d.Decode(ContentTypeAvro, wire(8, bin...)); !errors.Is(err, ErrUnknownSchema) {
+		t.Errorf("Ожидалась ErrUnknownSchema, получено %v", err)
+	}
+	if _, err := d.Decode(ContentTypeAvro, bin); !errors.Is(err, ErrWireFormat) {
+		t.Errorf("Ожидалась ErrWireFormat, получено %v", err)
+	}
+}
+
+// orderProto describes orders.proto: message Payment, message Order with nested Item.
+func orderProto() *descriptorpb.FileDescriptorSet {
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string, repeated bool) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		f := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(num), Type: typ.Enum(), Label: label.Enum()}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	const (
+		str = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		i64 = descriptorpb.FieldDescriptorProto_TYPE_INT64
+		msg = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	)
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("orders.proto"),
+		Package:    proto.String("orders"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Payment"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("amount", 1, i64, "", false),
+					field("currency", 2, str, "", false),
+				},
+			},
+			{
+				Name: proto.String("Order"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("order_uid", 1, str, "", false),
+					field("date_created", 2, msg, ".google.protobuf.Timestamp", false),
+					field("payment", 3, msg, ".orders.Payment", false),
+					field("items", 4, msg, ".orders.Order.Item", true),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{{
+					Name: proto.String("Item"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("chrt_id", 1, i64, "", false),
+						field("name", 2, str, "", false),
+					},
+				}},
+			},
+		},
+	}
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(timestamppb.File_google_protobuf_timestamp_proto),
+		file,
+	}}
+}
+
+func TestProtobufDecoder(t *testing.T) {
+	dir := t.TempDir()
+	set, err := proto.Marshal(orderProto())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "3.binpb"), set, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	schemas := NewSchemaRegistry(dir)
+
+	// Order is the second message of the file: indexes [1], encoded as count 1, index 1.
+	md, err := schemas.ProtoMessage(3, []int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := dynamicpb.NewMessage(md)
+	fields := md.Fields()
+	order.Set(fields.ByName("order_uid"), protoreflect.ValueOfString("1"))
+	created := order.Mutable(fields.ByName("date_created")).Message()
+	created.Set(created.Descriptor().Fields().ByName("seconds"), protoreflect.ValueOfInt64(1637907739))
+	payment := order.Mutable(fields.ByName("payment")).Message()
+	payment.Set(payment.Descriptor().Fields().ByName("amount"), protoreflect.ValueOfInt64(1817))
+	items := order.Mutable(fields.ByName("items")).List()
+	item := items.NewElement()
+	item.Message().Set(md.Messages().ByName("Item").Fields().ByName("chrt_id"), protoreflect.ValueOfInt64(9934930))
+	items.Append(item)
+	bin, err := proto.Marshal(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoders(schemas)
+	data, err := d.Decode(ContentTypeProtobuf, wire(3, append([]byte{2, 2}, bin...)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var o model.Order
+	if err := json.Unmarshal(data, &o); err != nil {
+		t.Fatalf("Ожидался JSON заказа, получено %s: %v", data, err)
+	}
+	if o.OrderUID != "1" || o.Payment.Amount != 1817 || len(o.Items) != 1 || o.Items[0].ChrtID != 9934930 {
+		t.Errorf("Неверно декодирован заказ: %s", data)
+	}
+	if !o.DateCreated.Equal(time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)) {
+		t.Errorf("Неверно декодирована дата: %s", o.DateCreated)
+	}
+
+	if _, err := d.Decode(ContentTypeProtobuf, wire(3, 2, 10)); !errors.Is(err, ErrUnknownSchema) {
+		t.Errorf("Ожидалась ErrUnknownSchema для индекса 5, получено %v", err)
+	}
+}
+
+func TestSplitMessageIndexes(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []int
+	}{
+		{"zero count", []byte{0, 42}, []int{0}},
+		{"nested", []byte{4, 2, 0, 42}, []int{1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rest, err := splitMessageIndexes(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Ожидались индексы %v, получено %v", tt.want, got)
+			}
+			if len(rest) != 1 || rest[0] != 42 {
+				t.Errorf("Ожидался остаток [42], получено %v", rest)
+			}
+		})
+	}
+
+	if _, _, err := splitMessageIndexes([]byte{1}); !errors.Is(err, ErrWireFormat) {
+		t.Errorf("Ожидалась ErrWireFormat для отрицательного числа индексов, получено %v", err)
+	}
+}
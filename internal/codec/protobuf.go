@@ -0,0 +1,107 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// ProtobufDecoder decodes Protobuf payloads in the Confluent wire format to JSON.
+// Protobuf field names must match the JSON fields of the model; time fields are
+// google.protobuf.Timestamp.
+type ProtobufDecoder struct {
+	schemas *SchemaRegistry
+}
+
+// Decode implements Decoder.
+func (d *ProtobufDecoder) Decode(data []byte) ([]byte, error) {
+	id, data, err := splitWire(data)
+	if err != nil {
+		return nil, err
+	}
+	indexes, data, err := splitMessageIndexes(data)
+	if err != nil {
+		return nil, err
+	}
+	md, err := d.schemas.ProtoMessage(id, indexes)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("некорректное Protobuf-сообщение %s (схема %d): %w", md.FullName(), id, err)
+	}
+	v, err := messageJSON(msg)
+	if err == nil {
+		data, err = json.Marshal(v)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("не удалось преобразовать Protobuf-сообщение %s (схема %d) в JSON: %w", md.FullName(), id, err)
+	}
+	return data, nil
+}
+
+// messageJSON converts a message to a JSON-encodable value. Unlike protojson it
+// keeps proto field names and encodes 64-bit integers as numbers, as the model
+// expects; well-known types are encoded by protojson.
+func messageJSON(m protoreflect.Message) (interface{}, error) {
+	if isWellKnown(m.Descriptor()) {
+		data, err := protojson.Marshal(m.Interface())
+		if err != nil {
+			return nil, err
+		}
+		return json.RawMessage(data), nil
+	}
+
+	out := make(map[string]interface{})
+	var err error
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		out[string(fd.Name())], err = fieldJSON(fd, v)
+		return err == nil
+	})
+	return out, err
+}
+
+func fieldJSON(fd protoreflect.FieldDescriptor, v protoreflect.Value) (interface{}, error) {
+	var err error
+	switch {
+	case fd.IsList():
+		list := v.List()
+		out := make([]interface{}, list.Len())
+		for i := 0; i < list.Len() && err == nil; i++ {
+			out[i], err = singularJSON(fd, list.Get(i))
+		}
+		return out, err
+	case fd.IsMap():
+		out := make(map[string]interface{})
+		v.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			out[k.String()], err = singularJSON(fd.MapValue(), v)
+			return err == nil
+		})
+		return out, err
+	}
+	return singularJSON(fd, v)
+}
+
+func singularJSON(fd protoreflect.FieldDescriptor, v protoreflect.Value) (interface{}, error) {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return messageJSON(v.Message())
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name()), nil
+		}
+		return int32(v.Enum()), nil
+	}
+	return v.Interface(), nil
+}
+
+func isWellKnown(md protoreflect.MessageDescriptor) bool {
+	return strings.HasPrefix(string(md.FullName()), "google.protobuf.")
+}
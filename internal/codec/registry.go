@@ -0,0 +1,142 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ErrUnknownSchema is returned for a schema id without a schema file.
+var ErrUnknownSchema = errors.New("схема не найдена")
+
+// Schema file extensions in the registry directory.
+const (
+	avroSchemaExt  = ".avsc"  // Avro schema JSON
+	protoSchemaExt = ".binpb" // FileDescriptorSet: protoc --include_imports --descriptor_set_out
+)
+
+// SchemaRegistry is a file-backed schema registry. The schema with id N is stored
+// in N.avsc (Avro) or N.binpb (Protobuf) in the registry directory. Schemas are
+// loaded on first use, so a new schema version is picked up by adding its file
+// without restarting the service. Like in the Confluent registry, a schema id
+// never changes its schema once used, so loaded schemas are not reread.
+type SchemaRegistry struct {
+	dir string
+
+	mu    sync.RWMutex
+	avro  map[uint32]*goavro.Codec
+	proto map[uint32]protoreflect.FileDescriptor
+}
+
+// NewSchemaRegistry creates a registry reading schemas from dir.
+func NewSchemaRegistry(dir string) *SchemaRegistry {
+	return &SchemaRegistry{
+		dir:   dir,
+		avro:  make(map[uint32]*goavro.Codec),
+		proto: make(map[uint32]protoreflect.FileDescriptor),
+	}
+}
+
+// Avro returns the codec of an Avro schema. The codec produces standard JSON,
+// without the type wrappers of Avro JSON unions.
+func (r *SchemaRegistry) Avro(id uint32) (*goavro.Codec, error) {
+	r.mu.RLock()
+	codec, ok := r.avro[id]
+	r.mu.RUnlock()
+	if ok {
+		return codec, nil
+	}
+
+	data, err := r.readSchema(id, avroSchemaExt)
+	if err != nil {
+		return nil, err
+	}
+	codec, err = goavro.NewCodecForStandardJSONFull(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("некорректная Avro-схема %d: %w", id, err)
+	}
+
+	r.mu.Lock()
+	r.avro[id] = codec
+	r.mu.Unlock()
+	return codec, nil
+}
+
+// ProtoMessage returns the descriptor of a Protobuf message by its indexes
+// in the schema file, see splitMessageIndexes.
+func (r *SchemaRegistry) ProtoMessage(id uint32, indexes []int) (protoreflect.MessageDescriptor, error) {
+	file, err := r.protoFile(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var md protoreflect.MessageDescriptor
+	msgs := file.Messages()
+	for _, i := range indexes {
+		if i >= msgs.Len() {
+			return nil, fmt.Errorf("%w: сообщение %v в схеме %d", ErrUnknownSchema, indexes, id)
+		}
+		md = msgs.Get(i)
+		msgs = md.Messages()
+	}
+	if md == nil {
+		return nil, fmt.Errorf("%w: сообщение %v в схеме %d", ErrUnknownSchema, indexes, id)
+	}
+	return md, nil
+}
+
+// protoFile returns the schema file of a Protobuf schema: the last file of the
+// descriptor set, since protoc lists imports before the files importing them.
+func (r *SchemaRegistry) protoFile(id uint32) (protoreflect.FileDescriptor, error) {
+	r.mu.RLock()
+	file, ok := r.proto[id]
+	r.mu.RUnlock()
+	if ok {
+		return file, nil
+	}
+
+	data, err := r.readSchema(id, protoSchemaExt)
+	if err != nil {
+		return nil, err
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("некорректная Protobuf-схема %d: %w", id, err)
+	}
+	if len(set.File) == 0 {
+		return nil, fmt.Errorf("некорректная Protobuf-схема %d: пустой набор файлов", id)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("некорректная Protobuf-схема %d: %w", id, err)
+	}
+	file, err = files.FindFileByPath(set.File[len(set.File)-1].GetName())
+	if err != nil {
+		return nil, fmt.Errorf("некорректная Protobuf-схема %d: %w", id, err)
+	}
+
+	r.mu.Lock()
+	r.proto[id] = file
+	r.mu.Unlock()
+	return file, nil
+}
+
+func (r *SchemaRegistry) readSchema(id uint32, ext string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(r.dir, strconv.FormatUint(uint64(id), 10)+ext))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: id %d", ErrUnknownSchema, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать схему %d: %w", id, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,50 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// wireMagic is the first byte of the Confluent wire format:
+// magic byte, 4-byte big-endian schema id, serialized data.
+const wireMagic = 0
+
+// ErrWireFormat is returned for a payload not in the Confluent wire format.
+var ErrWireFormat = errors.New("некорректный формат сообщения со схемой")
+
+// splitWire returns the schema id and the serialized data of a wire-format payload.
+func splitWire(data []byte) (uint32, []byte, error) {
+	if len(data) < 5 {
+		return 0, nil, fmt.Errorf("%w: длина %d байт", ErrWireFormat, len(data))
+	}
+	if data[0] != wireMagic {
+		return 0, nil, fmt.Errorf("%w: магический байт %d", ErrWireFormat, data[0])
+	}
+	return binary.BigEndian.Uint32(data[1:5]), data[5:], nil
+}
+
+// splitMessageIndexes reads the Protobuf message indexes following the schema id:
+// a zigzag varint count and that many zigzag varint indexes, the path to the
+// message type among the (nested) messages of the schema. A zero count means [0].
+func splitMessageIndexes(data []byte) ([]int, []byte, error) {
+	count, n := binary.Varint(data)
+	if n <= 0 || count < 0 || count > int64(len(data)) {
+		return nil, nil, fmt.Errorf("%w: некорректные индексы сообщения", ErrWireFormat)
+	}
+	data = data[n:]
+	if count == 0 {
+		return []int{0}, data, nil
+	}
+
+	indexes := make([]int, count)
+	for i := range indexes {
+		idx, n := binary.Varint(data)
+		if n <= 0 || idx < 0 {
+			return nil, nil, fmt.Errorf("%w: некорректные индексы сообщения", ErrWireFormat)
+		}
+		indexes[i] = int(idx)
+		data = data[n:]
+	}
+	return indexes, data, nil
+}
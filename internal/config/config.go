@@ -8,6 +8,12 @@ import (
 	"strconv"
 )
 
+// RetryTier - топик отложенных повторов: сообщение в нем обрабатывается не раньше чем через Delay.
+type RetryTier struct {
+	Topic string
+	Delay time.Duration
+}
+
 // Config содержит все настройки приложения.
 type Config struct {
 	DBUser       string
@@ -15,16 +21,54 @@ type Config struct {
 	DBName       string
 	DBHost       string
 	DBPort       string
+	DBAutoMigrate bool
 	KafkaBrokers []string
 	KafkaTopic   string
 	KafkaDeadTopic string
 	HTTPPort     string
+	// Bearer token for /admin endpoints; admin API is disabled when empty
+	AdminToken string
+	// Idempotency key of ingested orders: "content" or "request_id"
+	IngestIdempotencyKey string
+	// How long idempotency keys are kept; 0 keeps them forever
+	IdempotencyRetention time.Duration
+	// Reject ingested orders with unknown JSON fields
+	IngestStrict bool
+	// Business rule severities "rule=severity,...", see rules.ParseOverrides
+	IngestRules string
+	// Directory of Avro and Protobuf schemas named by schema id, see codec.SchemaRegistry;
+	// only JSON messages are accepted when empty
+	SchemaRegistryDir string
 	// Cache settings
 	CacheCapacity int
 	CacheTTL      time.Duration
+	CacheRestoreBatchSize int
+	// Cache warm-up settings
+	CacheWarmupPolicy string
+	CacheWarmupLimit  int
+	CacheWarmupWindow time.Duration
 	// Kafka retry settings
 	KafkaMaxRetries int
 	KafkaRetryBackoff time.Duration
+	KafkaRetryMaxBackoff time.Duration
+	KafkaRetryJitter     float64
+	// Tiered retry topics tried in order before the dead-letter topic
+	KafkaRetryTiers []RetryTier
+	// Kafka concurrency settings
+	KafkaWorkers int
+	// Kafka batch mode settings (batch mode is enabled when KafkaBatchSize > 1)
+	KafkaBatchSize    int
+	KafkaBatchTimeout time.Duration
+	// Transactional outbox relay settings
+	KafkaOutboxTopic   string
+	OutboxBatchSize    int
+	OutboxPollInterval time.Duration
+	OutboxRetention    time.Duration
+	// Deadline for draining the consumer and closing connections on shutdown
+	ShutdownTimeout time.Duration
+	// Restarts of crashed components (Kafka consumer, outbox relay)
+	ComponentMaxRestarts    int
+	ComponentRestartBackoff time.Duration
 }
 
 // NewConfig загружает конфигурацию из переменных окружения.
@@ -35,15 +79,44 @@ func NewConfig() *Config {
 		DBName:       getEnv("POSTGRES_DB", "orders_db"),
 		DBHost:       getEnv("DB_HOST", "localhost"),
 		DBPort:       getEnv("DB_PORT", "5432"),
+		DBAutoMigrate: getEnvAsBool("DB_AUTO_MIGRATE", true),
 		KafkaBrokers: strings.Split(getEnv("KAFKA_BROKER", "localhost:9092"), ","),
 		KafkaTopic:   getEnv("KAFKA_TOPIC", "orders"),
 		KafkaDeadTopic: getEnv("KAFKA_DEAD_TOPIC", "orders-dlq"),
 		HTTPPort:     getEnv("HTTP_PORT", "8081"),
+		AdminToken:   getEnv("ADMIN_TOKEN", ""),
+		IngestIdempotencyKey: getEnv("INGEST_IDEMPOTENCY_KEY", "content"),
+		IdempotencyRetention: getEnvAsDuration("IDEMPOTENCY_RETENTION", 7*24*time.Hour),
+		IngestStrict:         getEnvAsBool("INGEST_STRICT", false),
+		IngestRules:          getEnv("INGEST_RULES", ""),
+		SchemaRegistryDir:    getEnv("SCHEMA_REGISTRY_DIR", ""),
 		CacheCapacity: getEnvAsInt("CACHE_CAPACITY", 1000),
 		CacheTTL:      getEnvAsDuration("CACHE_TTL", 10*time.Minute),
+		CacheRestoreBatchSize: getEnvAsInt("CACHE_RESTORE_BATCH_SIZE", 500),
+		CacheWarmupPolicy: getEnv("CACHE_WARMUP_POLICY", "recent"),
+		CacheWarmupLimit:  getEnvAsInt("CACHE_WARMUP_LIMIT", 0),
+		CacheWarmupWindow: getEnvAsDuration("CACHE_WARMUP_WINDOW", 24*time.Hour),
 		KafkaMaxRetries: getEnvAsInt("KAFKA_MAX_RETRIES", 3),
 		KafkaRetryBackoff: getEnvAsDuration("KAFKA_RETRY_BACKOFF", 500*time.Millisecond),
+		KafkaRetryMaxBackoff: getEnvAsDuration("KAFKA_RETRY_MAX_BACKOFF", 10*time.Second),
+		KafkaRetryJitter:     getEnvAsFloat("KAFKA_RETRY_JITTER", 0.2),
+		KafkaWorkers: getEnvAsInt("KAFKA_WORKERS", 4),
+		KafkaBatchSize:    getEnvAsInt("KAFKA_BATCH_SIZE", 1),
+		KafkaBatchTimeout: getEnvAsDuration("KAFKA_BATCH_TIMEOUT", 200*time.Millisecond),
+		KafkaOutboxTopic:   getEnv("KAFKA_OUTBOX_TOPIC", "orders-stored"),
+		OutboxBatchSize:    getEnvAsInt("OUTBOX_BATCH_SIZE", 100),
+		OutboxPollInterval: getEnvAsDuration("OUTBOX_POLL_INTERVAL", time.Second),
+		OutboxRetention:    getEnvAsDuration("OUTBOX_RETENTION", 24*time.Hour),
+		ShutdownTimeout:    getEnvAsDuration("SHUTDOWN_TIMEOUT", 15*time.Second),
+		ComponentMaxRestarts:    getEnvAsInt("COMPONENT_MAX_RESTARTS", 5),
+		ComponentRestartBackoff: getEnvAsDuration("COMPONENT_RESTART_BACKOFF", time.Second),
+	}
+
+	tiers, err := parseRetryTiers(getEnv("KAFKA_RETRY_TOPICS", ""))
+	if err != nil {
+		panic(fmt.Sprintf("Ошибка валидации конфигурации: %v", err))
 	}
+	cfg.KafkaRetryTiers = tiers
 
 	if err := cfg.Validate(); err != nil {
 		panic(fmt.Sprintf("Ошибка валидации конфигурации: %v", err))
@@ -78,24 +151,118 @@ func (c *Config) Validate() error {
 	if c.HTTPPort == "" {
 		return fmt.Errorf("HTTP_PORT не может быть пустым")
 	}
+	switch c.IngestIdempotencyKey {
+	case "content", "message", "request_id":
+	default:
+		return fmt.Errorf("INGEST_IDEMPOTENCY_KEY must be one of content, message, request_id")
+	}
+	if c.SchemaRegistryDir != "" {
+		if info, err := os.Stat(c.SchemaRegistryDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("SCHEMA_REGISTRY_DIR: каталог %s не найден", c.SchemaRegistryDir)
+		}
+	}
 	if c.CacheCapacity <= 0 {
 		return fmt.Errorf("CACHE_CAPACITY must be positive")
 	}
 	if c.CacheTTL < 0 {
 		return fmt.Errorf("CACHE_TTL cannot be negative")
 	}
+	if c.CacheRestoreBatchSize <= 0 {
+		return fmt.Errorf("CACHE_RESTORE_BATCH_SIZE must be positive")
+	}
+	switch c.CacheWarmupPolicy {
+	case "none", "recent", "window":
+	default:
+		return fmt.Errorf("CACHE_WARMUP_POLICY must be one of none, recent, window")
+	}
+	if c.CacheWarmupLimit < 0 {
+		return fmt.Errorf("CACHE_WARMUP_LIMIT cannot be negative")
+	}
+	if c.CacheWarmupWindow <= 0 {
+		return fmt.Errorf("CACHE_WARMUP_WINDOW must be positive")
+	}
 	if c.KafkaDeadTopic == "" {
 		return fmt.Errorf("KAFKA_DEAD_TOPIC не может быть пустым")
 	}
 	if c.KafkaMaxRetries < 0 {
 		return fmt.Errorf("KAFKA_MAX_RETRIES cannot be negative")
 	}
-	if c.KafkaRetryBackoff < 0 {
-		return fmt.Errorf("KAFKA_RETRY_BACKOFF cannot be negative")
+	// the backoff also paces the unbounded retries of DLQ and retry topic writes
+	if c.KafkaRetryBackoff <= 0 {
+		return fmt.Errorf("KAFKA_RETRY_BACKOFF must be positive")
+	}
+	if c.KafkaRetryMaxBackoff < c.KafkaRetryBackoff {
+		return fmt.Errorf("KAFKA_RETRY_MAX_BACKOFF cannot be less than KAFKA_RETRY_BACKOFF")
+	}
+	if c.KafkaRetryJitter < 0 || c.KafkaRetryJitter > 1 {
+		return fmt.Errorf("KAFKA_RETRY_JITTER must be between 0 and 1")
+	}
+	for _, tier := range c.KafkaRetryTiers {
+		if tier.Topic == c.KafkaTopic || tier.Topic == c.KafkaDeadTopic {
+			return fmt.Errorf("KAFKA_RETRY_TOPICS: топик %s совпадает с основным или DLQ", tier.Topic)
+		}
+	}
+	if c.KafkaWorkers <= 0 {
+		return fmt.Errorf("KAFKA_WORKERS must be positive")
+	}
+	if c.KafkaBatchSize <= 0 {
+		return fmt.Errorf("KAFKA_BATCH_SIZE must be positive")
+	}
+	if c.KafkaBatchTimeout <= 0 {
+		return fmt.Errorf("KAFKA_BATCH_TIMEOUT must be positive")
+	}
+	if c.KafkaOutboxTopic == "" {
+		return fmt.Errorf("KAFKA_OUTBOX_TOPIC не может быть пустым")
+	}
+	if c.KafkaOutboxTopic == c.KafkaTopic {
+		return fmt.Errorf("KAFKA_OUTBOX_TOPIC не может совпадать с KAFKA_TOPIC")
+	}
+	if c.OutboxBatchSize <= 0 {
+		return fmt.Errorf("OUTBOX_BATCH_SIZE must be positive")
+	}
+	if c.OutboxPollInterval <= 0 {
+		return fmt.Errorf("OUTBOX_POLL_INTERVAL must be positive")
+	}
+	if c.OutboxRetention < 0 {
+		return fmt.Errorf("OUTBOX_RETENTION cannot be negative")
+	}
+	if c.IdempotencyRetention < 0 {
+		return fmt.Errorf("IDEMPOTENCY_RETENTION cannot be negative")
+	}
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("SHUTDOWN_TIMEOUT must be positive")
+	}
+	if c.ComponentMaxRestarts < 0 {
+		return fmt.Errorf("COMPONENT_MAX_RESTARTS cannot be negative")
+	}
+	if c.ComponentRestartBackoff <= 0 {
+		return fmt.Errorf("COMPONENT_RESTART_BACKOFF must be positive")
 	}
 	return nil
 }
 
+// parseRetryTiers разбирает список "topic=delay,topic=delay", например
+// "orders-retry-1m=1m,orders-retry-10m=10m". Пустая строка отключает отложенные повторы.
+func parseRetryTiers(value string) ([]RetryTier, error) {
+	var tiers []RetryTier
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		topic, delay, ok := strings.Cut(part, "=")
+		if !ok || topic == "" {
+			return nil, fmt.Errorf("KAFKA_RETRY_TOPICS: ожидается topic=delay, получено %q", part)
+		}
+		d, err := time.ParseDuration(delay)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("KAFKA_RETRY_TOPICS: некорректная задержка %q", delay)
+		}
+		tiers = append(tiers, RetryTier{Topic: topic, Delay: d})
+	}
+	return tiers, nil
+}
+
 // getEnv получает значение переменной окружения или возвращает значение по умолчанию.
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -113,6 +280,24 @@ func getEnvAsInt(key string, defaultVal int) int {
 	return defaultVal
 }
 
+func getEnvAsFloat(key string, defaultVal float64) float64 {
+	if v, ok := os.LookupEnv(key); ok {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return defaultVal
+}
+
+func getEnvAsBool(key string, defaultVal bool) bool {
+	if v, ok := os.LookupEnv(key); ok {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return defaultVal
+}
+
 func getEnvAsDuration(key string, defaultVal time.Duration) time.Duration {
 	if v, ok := os.LookupEnv(key); ok {
 		if d, err := time.ParseDuration(v); err == nil {
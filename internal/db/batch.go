@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/112Alex/demo-service.git/internal/model"
+)
+
+// SaveOrders сохраняет пачку заказов в одной транзакции с той же семантикой upsert, что и SaveOrder.
+// Товары всей пачки вставляются одной командой COPY.
+//
+// Устаревшие версии и повторы не прерывают пачку: для них в errs[i] возвращается
+// ErrStaleVersion или ErrDuplicate.
+// Любая другая ошибка откатывает всю пачку и возвращается как err; вызывающий
+// может повторить заказы по одному, чтобы изолировать проблемный. Как и в SaveOrder,
+// сохраненные значения записываются в заказы только после фиксации транзакции.
+func (c *DBClient) SaveOrders(ctx context.Context, orders []*model.Order) (errs []error, err error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %w", err)
+	}
+	defer tx.Rollback()
+
+	errs = make([]error, len(orders))
+	// Если заказ встречается в пачке несколько раз, его товары вставляются
+	// только для последнего сохраненного вхождения: предыдущие удалены в saveOrderTx.
+	last := make(map[string]int, len(orders))
+	saved := make([]*model.Order, len(orders))
+	for i, order := range orders {
+		stored, err := saveOrderTx(ctx, tx, order)
+		if err != nil {
+			if errors.Is(err, ErrStaleVersion) || errors.Is(err, ErrDuplicate) {
+				errs[i] = err
+				continue
+			}
+			return nil, fmt.Errorf("заказ %s: %w", order.OrderUID, err)
+		}
+		saved[i] = stored
+		last[order.OrderUID] = i
+	}
+
+	withItems := make([]*model.Order, 0, len(last))
+	for i, order := range orders {
+		if errs[i] == nil && last[order.OrderUID] == i {
+			withItems = append(withItems, saved[i])
+		}
+	}
+	if err := copyItems(ctx, tx, withItems); err != nil {
+		return nil, err
+	}
+
+	// События пишутся для каждого сохраненного вхождения в порядке пачки.
+	stored := make([]*model.Order, 0, len(orders))
+	for i := range orders {
+		if errs[i] == nil {
+			stored = append(stored, saved[i])
+		}
+	}
+	if err := insertOrderStored(ctx, tx, stored); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось зафиксировать пачку заказов: %w", err)
+	}
+	for i, order := range orders {
+		if errs[i] == nil {
+			*order = *saved[i]
+		}
+	}
+	return errs, nil
+}
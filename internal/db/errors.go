@@ -0,0 +1,61 @@
+package db
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ErrorClass говорит, имеет ли смысл повторять операцию, завершившуюся ошибкой.
+type ErrorClass string
+
+const (
+	// ErrorClassTransient - временная ошибка (сеть, перезапуск БД, конфликт сериализации), повтор может помочь.
+	ErrorClassTransient ErrorClass = "transient"
+	// ErrorClassPermanent - ошибка данных или схемы, повтор даст тот же результат.
+	ErrorClassPermanent ErrorClass = "permanent"
+)
+
+// Classify определяет класс ошибки, возвращенной методами DBClient.
+// Ошибки PostgreSQL классифицируются по SQLSTATE; остальные ошибки считаются
+// временными, чтобы не терять сообщения из-за сбоев инфраструктуры.
+func Classify(err error) ErrorClass {
+	if err == nil {
+		return ErrorClassPermanent
+	}
+	if errors.Is(err, ErrStaleVersion) || errors.Is(err, ErrDuplicate) || errors.Is(err, ErrInvalidTransition) ||
+		errors.Is(err, ErrRefundExceedsPayment) {
+		return ErrorClassPermanent
+	}
+	// Заказ для изменения статуса или возврата мог еще не дойти (например, он в топике отложенных повторов).
+	if errors.Is(err, ErrOrderNotFound) {
+		return ErrorClassTransient
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		code := string(pqErr.Code)
+		switch {
+		case strings.HasPrefix(code, "08"), // connection_exception
+			code == "40001",                                   // serialization_failure
+			code == "40P01",                                   // deadlock_detected
+			code == "55P03",                                   // lock_not_available
+			code == "57014",                                   // query_canceled (statement_timeout)
+			strings.HasPrefix(code, "53"),                     // insufficient_resources
+			code == "57P01", code == "57P02", code == "57P03": // admin_shutdown, crash_shutdown, cannot_connect_now
+			return ErrorClassTransient
+		default:
+			return ErrorClassPermanent
+		}
+	}
+
+	// Сетевые ошибки (driver.ErrBadConn, io.EOF, сброс соединения, таймауты)
+	// и прочие неизвестные ошибки считаются временными.
+	return ErrorClassTransient
+}
+
+// IsRetryable сообщает, что операцию стоит повторить.
+func IsRetryable(err error) bool {
+	return err != nil && Classify(err) == ErrorClassTransient
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"unique violation", &pq.Error{Code: "23505"}, ErrorClassPermanent},
+		{"not null violation", fmt.Errorf("не удалось сохранить заказ: %w", &pq.Error{Code: "23502"}), ErrorClassPermanent},
+		{"serialization failure", &pq.Error{Code: "40001"}, ErrorClassTransient},
+		{"connection failure", &pq.Error{Code: "08006"}, ErrorClassTransient},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, ErrorClassTransient},
+		{"bad connection", driver.ErrBadConn, ErrorClassTransient},
+		{"stale version", fmt.Errorf("%w: версия 1", ErrStaleVersion), ErrorClassPermanent},
+		{"duplicate", fmt.Errorf("%w: ключ k", ErrDuplicate), ErrorClassPermanent},
+		{"invalid transition", fmt.Errorf("%w: delivered -> paid", ErrInvalidTransition), ErrorClassPermanent},
+		{"refund exceeds payment", fmt.Errorf("%w: заказ 1", ErrRefundExceedsPayment), ErrorClassPermanent},
+		{"order not found", fmt.Errorf("%w: 1", ErrOrderNotFound), ErrorClassTransient},
+		{"unknown", errors.New("connection reset by peer"), ErrorClassTransient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("Ожидался класс %s, получен %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrDuplicate возвращается, если сообщение с тем же ключом идемпотентности уже обработано.
+var ErrDuplicate = errors.New("сообщение уже обработано")
+
+// claimIdempotencyKey записывает ключ идемпотентности сообщения о заказе orderUID
+// в журнал processed_messages в рамках транзакции tx. Если ключ уже записан, возвращается ErrDuplicate.
+// Параллельная транзакция с тем же ключом ждет фиксации первой, поэтому
+// сообщение не может быть обработано дважды. Пустой ключ не проверяется.
+func claimIdempotencyKey(ctx context.Context, tx *sql.Tx, key, orderUID string) error {
+	if key == "" {
+		return nil
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO processed_messages (idempotency_key, order_uid)
+		VALUES ($1, $2)
+		ON CONFLICT (idempotency_key) DO NOTHING`,
+		key, orderUID)
+	if err != nil {
+		return fmt.Errorf("не удалось записать ключ идемпотентности: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("не удалось записать ключ идемпотентности: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: заказ %s, ключ %s", ErrDuplicate, orderUID, key)
+	}
+	return nil
+}
+
+// PurgeProcessedMessages удаляет ключи идемпотентности, записанные раньше before,
+// и возвращает их количество. После удаления сообщение с таким ключом снова принимается.
+func (c *DBClient) PurgeProcessedMessages(ctx context.Context, before time.Time) (int64, error) {
+	res, err := c.db.ExecContext(ctx, `DELETE FROM processed_messages WHERE processed_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка очистки журнала processed_messages: %w", err)
+	}
+	return res.RowsAffected()
+}
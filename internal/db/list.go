@@ -0,0 +1,273 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/112Alex/demo-service.git/internal/model"
+)
+
+const (
+	// DefaultListLimit - размер страницы по умолчанию для ListOrders.
+	DefaultListLimit = 50
+	// MaxListLimit - максимальный размер страницы для ListOrders.
+	MaxListLimit = 500
+)
+
+// ErrInvalidCursor возвращается, если курсор пагинации не удалось разобрать.
+var ErrInvalidCursor = errors.New("некорректный курсор пагинации")
+
+// OrderFilter описывает фильтры и параметры пагинации для ListOrders.
+// Пустые поля не участвуют в фильтрации.
+type OrderFilter struct {
+	CustomerID      string
+	TrackNumber     string
+	DeliveryService string
+	Locale          string
+	CreatedFrom     time.Time // включительно
+	CreatedTo       time.Time // не включительно
+	Cursor          string
+	Limit           int
+}
+
+// OrderPage - страница результатов ListOrders.
+// NextCursor пуст, если следующей страницы нет.
+type OrderPage struct {
+	Orders     []*model.Order `json:"orders"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// ListOrders возвращает страницу заказов, отсортированных по date_created (от новых к старым).
+// Пагинация курсорная: курсор кодирует (date_created, order_uid) последнего заказа страницы.
+func (c *DBClient) ListOrders(ctx context.Context, f OrderFilter) (*OrderPage, error) {
+	limit := f.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+
+	var (
+		conds []string
+		args  []interface{}
+	)
+	addCond := func(expr string, vals ...interface{}) {
+		for _, v := range vals {
+			args = append(args, v)
+			expr = strings.Replace(expr, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+		conds = append(conds, expr)
+	}
+
+	if f.CustomerID != "" {
+		addCond("customer_id = ?", f.CustomerID)
+	}
+	if f.TrackNumber != "" {
+		addCond("track_number = ?", f.TrackNumber)
+	}
+	if f.DeliveryService != "" {
+		addCond("delivery_service = ?", f.DeliveryService)
+	}
+	if f.Locale != "" {
+		addCond("locale = ?", f.Locale)
+	}
+	if !f.CreatedFrom.IsZero() {
+		addCond("date_created >= ?", f.CreatedFrom)
+	}
+	if !f.CreatedTo.IsZero() {
+		addCond("date_created < ?", f.CreatedTo)
+	}
+	if f.Cursor != "" {
+		createdAt, orderUID, err := decodeCursor(f.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		addCond("(date_created, order_uid) < (?, ?)", createdAt, orderUID)
+	}
+
+	query := `
+		SELECT ` + orderColumns + `
+		FROM orders`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" ORDER BY date_created DESC, order_uid DESC LIMIT $%d", len(args))
+
+	orders, err := c.queryOrderHeaders(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &OrderPage{Orders: orders}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		last := page.Orders[limit-1]
+		page.NextCursor = encodeCursor(last.DateCreated, last.OrderUID)
+	}
+
+	if err := c.loadOrderDetails(ctx, page.Orders); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// GetOrdersByTrackNumber возвращает все заказы с указанным трек-номером, от новых к старым.
+func (c *DBClient) GetOrdersByTrackNumber(ctx context.Context, trackNumber string) ([]*model.Order, error) {
+	return c.findOrders(ctx, "track_number = $1", trackNumber)
+}
+
+// GetOrdersByCustomerID возвращает все заказы покупателя, от новых к старым.
+func (c *DBClient) GetOrdersByCustomerID(ctx context.Context, customerID string) ([]*model.Order, error) {
+	return c.findOrders(ctx, "customer_id = $1", customerID)
+}
+
+// findOrders загружает полные заказы, удовлетворяющие условию cond.
+func (c *DBClient) findOrders(ctx context.Context, cond string, args ...interface{}) ([]*model.Order, error) {
+	orders, err := c.queryOrderHeaders(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders WHERE `+cond+`
+		ORDER BY date_created DESC, order_uid DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.loadOrderDetails(ctx, orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// queryOrderHeaders выполняет запрос к таблице orders и сканирует основные поля заказов.
+func (c *DBClient) queryOrderHeaders(ctx context.Context, query string, args ...interface{}) ([]*model.Order, error) {
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении списка заказов: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []*model.Order
+	for rows.Next() {
+		order := &model.Order{}
+		if err := scanOrder(rows, order); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании заказа: %w", err)
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка итерации по заказам: %w", err)
+	}
+	return orders, nil
+}
+
+// loadOrderDetails догружает доставку, оплату и товары для набора заказов
+// тремя запросами вместо трех запросов на каждый заказ.
+func (c *DBClient) loadOrderDetails(ctx context.Context, orders []*model.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	byUID := make(map[string]*model.Order, len(orders))
+	uids := make([]string, 0, len(orders))
+	for _, o := range orders {
+		byUID[o.OrderUID] = o
+		uids = append(uids, o.OrderUID)
+	}
+
+	// Доставка
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT order_uid, name, phone, zip, city, address, region, email
+		FROM delivery WHERE order_uid = ANY($1)`, pq.Array(uids))
+	if err != nil {
+		return fmt.Errorf("ошибка при получении доставки: %w", err)
+	}
+	for rows.Next() {
+		var d model.Delivery
+		if err := rows.Scan(&d.OrderUID, &d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email); err != nil {
+			rows.Close()
+			return fmt.Errorf("ошибка при сканировании доставки: %w", err)
+		}
+		if o, ok := byUID[d.OrderUID]; ok {
+			o.Delivery = d
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка итерации по доставке: %w", err)
+	}
+
+	// Оплата
+	rows, err = c.db.QueryContext(ctx, `
+		SELECT order_uid, transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee, `+refundedColumn+`
+		FROM payment WHERE order_uid = ANY($1)`, pq.Array(uids))
+	if err != nil {
+		return fmt.Errorf("ошибка при получении оплаты: %w", err)
+	}
+	for rows.Next() {
+		var p model.Payment
+		if err := rows.Scan(&p.OrderUID, &p.Transaction, &p.RequestID, &p.Currency, &p.Provider, &p.Amount, &p.PaymentDt, &p.Bank, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee, &p.Refunded); err != nil {
+			rows.Close()
+			return fmt.Errorf("ошибка при сканировании оплаты: %w", err)
+		}
+		if o, ok := byUID[p.OrderUID]; ok {
+			o.Payment = p
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка итерации по оплатам: %w", err)
+	}
+
+	// Товары
+	rows, err = c.db.QueryContext(ctx, `
+		SELECT order_uid, line_no, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
+		FROM items WHERE order_uid = ANY($1)
+		ORDER BY order_uid, line_no`, pq.Array(uids))
+	if err != nil {
+		return fmt.Errorf("ошибка при получении товаров: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item model.Item
+		if err := rows.Scan(&item.OrderUID, &item.LineNo, &item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid, &item.Name, &item.Sale, &item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status); err != nil {
+			return fmt.Errorf("ошибка при сканировании товара: %w", err)
+		}
+		if o, ok := byUID[item.OrderUID]; ok {
+			o.Items = append(o.Items, item)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка итерации по товарам: %w", err)
+	}
+
+	return nil
+}
+
+// encodeCursor упаковывает позицию последнего заказа страницы в непрозрачную строку.
+func encodeCursor(createdAt time.Time, orderUID string) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "|" + orderUID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor разбирает строку, полученную из encodeCursor.
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	ts, uid, ok := strings.Cut(string(raw), "|")
+	if !ok || uid == "" {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return createdAt, uid, nil
+}
@@ -0,0 +1,31 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	createdAt := time.Date(2021, 11, 26, 6, 22, 19, 123, time.UTC)
+	cursor := encodeCursor(createdAt, "b563feb7b2b84b6test")
+
+	gotTime, gotUID, err := decodeCursor(cursor)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !gotTime.Equal(createdAt) {
+		t.Errorf("Ожидалось время %v, получено %v", createdAt, gotTime)
+	}
+	if gotUID != "b563feb7b2b84b6test" {
+		t.Errorf("Ожидался order_uid b563feb7b2b84b6test, получен %s", gotUID)
+	}
+}
+
+func TestCursor_Invalid(t *testing.T) {
+	for _, cursor := range []string{"!!!", "bm8tc2VwYXJhdG9y", "MjAyMXx4"} {
+		if _, _, err := decodeCursor(cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("cursor %q: ожидалась ErrInvalidCursor, получено %v", cursor, err)
+		}
+	}
+}
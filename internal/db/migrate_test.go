@@ -0,0 +1,21 @@
+package db
+
+import "testing"
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("Ожидалась хотя бы одна миграция")
+	}
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("Ожидалась версия %d, получена %d (%s)", i+1, m.Version, m.Name)
+		}
+		if m.Up == "" || m.Down == "" {
+			t.Errorf("Миграция %d_%s без up или down", m.Version, m.Name)
+		}
+	}
+}
@@ -1,3 +1,6 @@
+-- Base schema (formerly init.sql). Idempotent: also upgrades databases
+-- created by earlier versions of init.sql.
+
 CREATE TABLE IF NOT EXISTS orders (
     order_uid VARCHAR(255) PRIMARY KEY,
     track_number VARCHAR(255) NOT NULL,
@@ -9,7 +12,9 @@ CREATE TABLE IF NOT EXISTS orders (
     shardkey VARCHAR(10) NOT NULL,
     sm_id INTEGER NOT NULL,
     date_created TIMESTAMP WITH TIME ZONE NOT NULL,
-    oof_shard VARCHAR(10) NOT NULL
+    oof_shard VARCHAR(10) NOT NULL,
+    version BIGINT NOT NULL DEFAULT 1,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
 );
 
 CREATE TABLE IF NOT EXISTS delivery (
@@ -39,7 +44,9 @@ CREATE TABLE IF NOT EXISTS payment (
 );
 
 CREATE TABLE IF NOT EXISTS items (
-    chrt_id INTEGER PRIMARY KEY,
+    order_uid VARCHAR(255) NOT NULL REFERENCES orders(order_uid) ON DELETE CASCADE,
+    line_no INTEGER NOT NULL,
+    chrt_id INTEGER NOT NULL,
     track_number VARCHAR(255) NOT NULL,
     price INTEGER NOT NULL,
     rid VARCHAR(255) NOT NULL,
@@ -50,11 +57,35 @@ CREATE TABLE IF NOT EXISTS items (
     nm_id INTEGER NOT NULL,
     brand VARCHAR(255) NOT NULL,
     status INTEGER NOT NULL,
-    order_uid VARCHAR(255) REFERENCES orders(order_uid) ON DELETE CASCADE
+    PRIMARY KEY (order_uid, line_no)
 );
 
 -- Indexes to improve query performance
 CREATE INDEX IF NOT EXISTS idx_orders_track_number ON orders(track_number);
 CREATE INDEX IF NOT EXISTS idx_orders_customer_id ON orders(customer_id);
 CREATE INDEX IF NOT EXISTS idx_items_order_uid ON items(order_uid);
-CREATE INDEX IF NOT EXISTS idx_payment_order_uid ON payment(order_uid);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_payment_order_uid ON payment(order_uid);
+
+-- Upgrade of databases created before order versioning
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+
+-- Upgrade of databases where items.chrt_id was the primary key:
+-- existing lines are numbered by chrt_id within each order.
+ALTER TABLE items ADD COLUMN IF NOT EXISTS line_no INTEGER;
+UPDATE items i SET line_no = n.rn
+FROM (SELECT ctid, row_number() OVER (PARTITION BY order_uid ORDER BY chrt_id) AS rn FROM items) n
+WHERE i.ctid = n.ctid AND i.line_no IS NULL;
+DELETE FROM items WHERE order_uid IS NULL;
+ALTER TABLE items ALTER COLUMN line_no SET NOT NULL;
+ALTER TABLE items ALTER COLUMN order_uid SET NOT NULL;
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.key_column_usage
+        WHERE table_name = 'items' AND constraint_name = 'items_pkey' AND column_name = 'line_no'
+    ) THEN
+        ALTER TABLE items DROP CONSTRAINT IF EXISTS items_pkey;
+        ALTER TABLE items ADD CONSTRAINT items_pkey PRIMARY KEY (order_uid, line_no);
+    END IF;
+END $$;
@@ -0,0 +1,2 @@
+-- Supports newest-first listing (GET /orders) and cache warm-up.
+CREATE INDEX IF NOT EXISTS idx_orders_date_created ON orders (date_created DESC, order_uid DESC);
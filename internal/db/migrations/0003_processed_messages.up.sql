@@ -0,0 +1,9 @@
+-- Idempotency ledger: one row per ingested message, written in the same
+-- transaction as the order, so a redelivered message is detected as a duplicate.
+CREATE TABLE IF NOT EXISTS processed_messages (
+    idempotency_key TEXT PRIMARY KEY,
+    order_uid TEXT NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_messages_processed_at ON processed_messages (processed_at);
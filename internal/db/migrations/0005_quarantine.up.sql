@@ -0,0 +1,16 @@
+-- Quarantine: orders breaking business rules of quarantine severity are held
+-- here, outside the main tables, until an operator approves or rejects them.
+CREATE TABLE IF NOT EXISTS quarantine (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid TEXT NOT NULL,
+    idempotency_key TEXT,
+    payload JSONB NOT NULL,
+    violations JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    reviewed_at TIMESTAMPTZ,
+    review_note TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_quarantine_order_uid ON quarantine (order_uid);
+CREATE INDEX IF NOT EXISTS idx_quarantine_pending ON quarantine (id) WHERE status = 'pending';
@@ -0,0 +1,21 @@
+-- Order status lifecycle: the current status lives in orders.status, every
+-- change (including creation) is recorded in order_status_history.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'created';
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid VARCHAR(255) NOT NULL REFERENCES orders(order_uid) ON DELETE CASCADE,
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    occurred_at TIMESTAMPTZ NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order_uid ON order_status_history (order_uid, id);
+
+-- Existing orders start their history at creation.
+INSERT INTO order_status_history (order_uid, to_status, occurred_at)
+SELECT o.order_uid, o.status, o.date_created
+FROM orders o
+WHERE NOT EXISTS (SELECT 1 FROM order_status_history h WHERE h.order_uid = o.order_uid);
@@ -0,0 +1 @@
+ALTER TABLE quarantine DROP COLUMN IF EXISTS base_version;
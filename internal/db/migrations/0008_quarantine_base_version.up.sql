@@ -0,0 +1,4 @@
+-- Version of the stored order when it was quarantined (0: the order did not exist).
+-- Approval is refused if the order has changed since. NULL for entries created
+-- before this migration, which are approved without the check.
+ALTER TABLE quarantine ADD COLUMN IF NOT EXISTS base_version BIGINT;
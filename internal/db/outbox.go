@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/112Alex/demo-service.git/internal/model"
+)
+
+// EventOrderStored - тип события о сохранении заказа.
+const EventOrderStored = "OrderStored"
+
+// outboxLockID - ключ advisory lock, под которым события outbox публикует
+// только один экземпляр сервиса, что сохраняет порядок событий заказа.
+const outboxLockID = 7_351_902_115
+
+// OutboxEvent - событие, ожидающее публикации.
+type OutboxEvent struct {
+	ID        int64
+	OrderUID  string
+	EventType string
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+// insertOrderStored записывает в outbox события OrderStored для сохраненных заказов
+// в рамках транзакции tx. Событие содержит заказ в том виде, в котором он сохранен.
+func insertOrderStored(ctx context.Context, tx *sql.Tx, orders []*model.Order) error {
+	for _, order := range orders {
+		payload, err := json.Marshal(order)
+		if err != nil {
+			return fmt.Errorf("не удалось сериализовать заказ %s: %w", order.OrderUID, err)
+		}
+		event, err := json.Marshal(model.EventEnvelope{
+			Type:       EventOrderStored,
+			Version:    1,
+			OccurredAt: order.UpdatedAt,
+			Payload:    payload,
+		})
+		if err != nil {
+			return fmt.Errorf("не удалось сериализовать событие заказа %s: %w", order.OrderUID, err)
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO outbox (order_uid, event_type, payload) VALUES ($1, $2, $3)`,
+			order.OrderUID, EventOrderStored, event)
+		if err != nil {
+			return fmt.Errorf("не удалось записать событие заказа %s в outbox: %w", order.OrderUID, err)
+		}
+	}
+	return nil
+}
+
+// PublishOutbox передает в publish до limit неопубликованных событий в порядке id
+// и помечает их опубликованными, если publish завершился без ошибки.
+// Если события публикует другой экземпляр сервиса, возвращает 0 без вызова publish.
+// Возвращает число опубликованных событий.
+func (c *DBClient) PublishOutbox(ctx context.Context, limit int, publish func([]OutboxEvent) error) (int, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось начать транзакцию: %w", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, outboxLockID).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("ошибка блокировки outbox: %w", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, order_uid, event_type, payload, created_at
+		FROM outbox WHERE published_at IS NULL
+		ORDER BY id LIMIT $1`, limit)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка чтения outbox: %w", err)
+	}
+	var (
+		events []OutboxEvent
+		ids    []int64
+	)
+	for rows.Next() {
+		var e OutboxEvent
+		if err := rows.Scan(&e.ID, &e.OrderUID, &e.EventType, &e.Payload, &e.CreatedAt); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("ошибка при сканировании события outbox: %w", err)
+		}
+		events = append(events, e)
+		ids = append(ids, e.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("ошибка итерации по outbox: %w", err)
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	if err := publish(events); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE outbox SET published_at = now() WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+		return 0, fmt.Errorf("не удалось отметить события outbox: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("не удалось зафиксировать публикацию outbox: %w", err)
+	}
+	return len(events), nil
+}
+
+// PurgeOutbox удаляет события, опубликованные раньше before, и возвращает их количество.
+func (c *DBClient) PurgeOutbox(ctx context.Context, before time.Time) (int64, error) {
+	res, err := c.db.ExecContext(ctx, `DELETE FROM outbox WHERE published_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка очистки outbox: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -3,15 +3,25 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/lib/pq"
+
 	"github.com/112Alex/demo-service.git/internal/model"
 )
 
+// ErrStaleVersion возвращается SaveOrder, если сохранена та же или более новая версия заказа.
+var ErrStaleVersion = errors.New("устаревшая версия заказа")
+
+// orderColumns - столбцы таблицы orders в порядке, ожидаемом scanOrder.
+const orderColumns = `order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, version, updated_at, status`
+
 type DBClient struct {
 	db *sql.DB
 }
@@ -45,7 +55,24 @@ func (c *DBClient) Close() error {
 	return c.db.Close()
 }
 
+// Ping проверяет доступность БД.
+func (c *DBClient) Ping(ctx context.Context) error {
+	return c.db.PingContext(ctx)
+}
+
 // SaveOrder сохраняет полную информацию о заказе в БД, используя транзакцию.
+//
+// Если заказ уже существует, он заменяется целиком (включая набор товаров):
+//   - order.Version > 0 - оптимистическая проверка: версия должна быть больше сохраненной,
+//     иначе возвращается ErrStaleVersion и БД не меняется;
+//   - order.Version == 0 - last-writer-wins: версия увеличивается на единицу; если задан
+//     order.UnchangedSince, а сохраненный заказ изменен позже, возвращается ErrStaleVersion.
+//
+// Если order.IdempotencyKey уже есть в журнале processed_messages, возвращается ErrDuplicate.
+// В той же транзакции в outbox записывается событие OrderStored.
+// Статус заказа не меняется (см. UpdateOrderStatus); новый заказ получает статус created.
+// При успешной фиксации order.Version, order.UpdatedAt, order.Status, order.Payment.Refunded
+// и order.Created заполняются сохраненными значениями; при ошибке order не меняется и его можно повторить.
 func (c *DBClient) SaveOrder(ctx context.Context, order *model.Order) error {
 	tx, err := c.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -53,48 +80,180 @@ func (c *DBClient) SaveOrder(ctx context.Context, order *model.Order) error {
 	}
 	defer tx.Rollback()
 
-	_, err = tx.ExecContext(ctx, `
-		INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		ON CONFLICT (order_uid) DO NOTHING`,
-		order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature, order.CustomerID, order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard)
+	stored, err := saveOrderTx(ctx, tx, order)
+	if err != nil {
+		return err
+	}
+	if err := copyItems(ctx, tx, []*model.Order{stored}); err != nil {
+		return err
+	}
+	if err := insertOrderStored(ctx, tx, []*model.Order{stored}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil { // Фиксация транзакции
+		return err
+	}
+	*order = *stored
+	return nil
+}
+
+// saveOrderTx выполняет upsert заказа (без вставки товаров) в рамках транзакции tx.
+// Повторно полученное сообщение (см. claimIdempotencyKey) не меняет БД и дает ErrDuplicate.
+// Возвращает копию order с сохраненными версией, updated_at, статусом и суммой возвратов;
+// сам order не меняется, так как транзакция еще может быть откачена.
+func saveOrderTx(ctx context.Context, tx *sql.Tx, order *model.Order) (*model.Order, error) {
+	if err := claimIdempotencyKey(ctx, tx, order.IdempotencyKey, order.OrderUID); err != nil {
+		return nil, err
+	}
+
+	current, exists, err := lockOrderVersion(ctx, tx, order.OrderUID)
 	if err != nil {
-		return fmt.Errorf("не удалось сохранить заказ: %w", err)
+		return nil, err
+	}
+
+	stored := *order
+	stored.Created = false
+
+	if !exists {
+		version := order.Version
+		if version <= 0 {
+			version = 1
+		}
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, version, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, now())
+			ON CONFLICT (order_uid) DO NOTHING
+			RETURNING version, updated_at, status`,
+			order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature, order.CustomerID, order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard, version).
+			Scan(&stored.Version, &stored.UpdatedAt, &stored.Status)
+		switch {
+		case err == sql.ErrNoRows:
+			// Заказ вставлен параллельной транзакцией: блокируем его и обновляем как существующий.
+			if current, _, err = lockOrderVersion(ctx, tx, order.OrderUID); err != nil {
+				return nil, err
+			}
+			exists = true
+		case err != nil:
+			return nil, fmt.Errorf("не удалось сохранить заказ: %w", err)
+		default:
+			stored.Created = true
+			// История статусов начинается с создания заказа.
+			change := model.StatusChange{To: stored.Status, OccurredAt: order.DateCreated}
+			if err := insertStatusChange(ctx, tx, order.OrderUID, change); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if exists {
+		if order.Version > 0 && order.Version <= current {
+			return nil, fmt.Errorf("%w: версия %d, сохранена %d", ErrStaleVersion, order.Version, current)
+		}
+		if order.Version <= 0 && !order.UnchangedSince.IsZero() {
+			var updatedAt time.Time
+			err := tx.QueryRowContext(ctx, `SELECT updated_at FROM orders WHERE order_uid = $1`, order.OrderUID).Scan(&updatedAt)
+			if err != nil {
+				return nil, fmt.Errorf("не удалось получить время изменения заказа: %w", err)
+			}
+			if updatedAt.After(order.UnchangedSince) {
+				return nil, fmt.Errorf("%w: заказ изменен %s, позже %s", ErrStaleVersion,
+					updatedAt.Format(time.RFC3339Nano), order.UnchangedSince.Format(time.RFC3339Nano))
+			}
+		}
+		version := order.Version
+		if version <= 0 {
+			version = current + 1
+		}
+		err = tx.QueryRowContext(ctx, `
+			UPDATE orders SET track_number = $2, entry = $3, locale = $4, internal_signature = $5, customer_id = $6,
+				delivery_service = $7, shardkey = $8, sm_id = $9, date_created = $10, oof_shard = $11, version = $12, updated_at = now()
+			WHERE order_uid = $1
+			RETURNING version, updated_at, status`,
+			order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature, order.CustomerID, order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard, version).
+			Scan(&stored.Version, &stored.UpdatedAt, &stored.Status)
+		if err != nil {
+			return nil, fmt.Errorf("не удалось обновить заказ: %w", err)
+		}
 	}
 
 	// Сохранение информации о доставке
 	_, err = tx.ExecContext(ctx, `
 		INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		ON CONFLICT (order_uid) DO NOTHING`,
+		ON CONFLICT (order_uid) DO UPDATE SET name = EXCLUDED.name, phone = EXCLUDED.phone, zip = EXCLUDED.zip,
+			city = EXCLUDED.city, address = EXCLUDED.address, region = EXCLUDED.region, email = EXCLUDED.email`,
 		order.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip, order.Delivery.City, order.Delivery.Address, order.Delivery.Region, order.Delivery.Email)
 	if err != nil {
-		return fmt.Errorf("не удалось сохранить доставку: %w", err)
+		return nil, fmt.Errorf("не удалось сохранить доставку: %w", err)
 	}
 
-	// Сохранение информации об оплате
+	// Сохранение информации об оплате. transaction - глобальный ключ, поэтому
+	// оплата заказа заменяется целиком; чужая transaction приведет к ошибке уникальности.
+	if _, err = tx.ExecContext(ctx, `DELETE FROM payment WHERE order_uid = $1`, order.OrderUID); err != nil {
+		return nil, fmt.Errorf("не удалось заменить оплату: %w", err)
+	}
 	_, err = tx.ExecContext(ctx, `
 		INSERT INTO payment (transaction, order_uid, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		ON CONFLICT (transaction) DO NOTHING`,
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
 		order.Payment.Transaction, order.OrderUID, order.Payment.RequestID, order.Payment.Currency, order.Payment.Provider, order.Payment.Amount, order.Payment.PaymentDt, order.Payment.Bank, order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee)
 	if err != nil {
-		return fmt.Errorf("не удалось сохранить оплату: %w", err)
+		return nil, fmt.Errorf("не удалось сохранить оплату: %w", err)
+	}
+	// Сумма возвратов ведется событиями PaymentRefunded, а не присылается с заказом.
+	err = tx.QueryRowContext(ctx, `SELECT `+refundedColumn+` FROM payment WHERE order_uid = $1`, order.OrderUID).
+		Scan(&stored.Payment.Refunded)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось получить сумму возвратов: %w", err)
 	}
 
-	// Сохранение товаров
-	for _, item := range order.Items {
-		_, err = tx.ExecContext(ctx, `
-			INSERT INTO items (chrt_id, order_uid, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
-			ON CONFLICT (chrt_id) DO NOTHING`,
-			item.ChrtID, order.OrderUID, item.TrackNumber, item.Price, item.Rid, item.Name, item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status)
-		if err != nil {
-			return fmt.Errorf("не удалось сохранить товар %d: %w", item.ChrtID, err)
+	// Набор товаров заменяется целиком; новые строки вставляет copyItems.
+	if _, err = tx.ExecContext(ctx, `DELETE FROM items WHERE order_uid = $1`, order.OrderUID); err != nil {
+		return nil, fmt.Errorf("не удалось заменить товары: %w", err)
+	}
+
+	return &stored, nil
+}
+
+// copyItems вставляет товары заказов одной командой COPY.
+// Номера строк присваиваются по позиции товара в заказе.
+func copyItems(ctx context.Context, tx *sql.Tx, orders []*model.Order) error {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("items",
+		"order_uid", "line_no", "chrt_id", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status"))
+	if err != nil {
+		return fmt.Errorf("не удалось начать вставку товаров: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, order := range orders {
+		for i := range order.Items {
+			item := &order.Items[i]
+			item.OrderUID = order.OrderUID
+			item.LineNo = i + 1
+			_, err = stmt.ExecContext(ctx, order.OrderUID, item.LineNo, item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name, item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status)
+			if err != nil {
+				return fmt.Errorf("не удалось сохранить товар %d заказа %s: %w", item.ChrtID, order.OrderUID, err)
+			}
 		}
 	}
 
-	return tx.Commit() // Фиксация транзакции
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("не удалось сохранить товары: %w", err)
+	}
+	return nil
+}
+
+// lockOrderVersion блокирует строку заказа до конца транзакции и возвращает его версию.
+func lockOrderVersion(ctx context.Context, tx *sql.Tx, orderUID string) (int64, bool, error) {
+	var version int64
+	err := tx.QueryRowContext(ctx, `SELECT version FROM orders WHERE order_uid = $1 FOR UPDATE`, orderUID).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("не удалось заблокировать заказ: %w", err)
+	}
+	return version, true, nil
 }
 
 // GetOrderFromDB загружает полную информацию о заказе из БД.
@@ -102,10 +261,9 @@ func (c *DBClient) GetOrderFromDB(ctx context.Context, orderUID string) (*model.
 	order := &model.Order{}
 
 	// Загрузка основной информации о заказе
-	err := c.db.QueryRowContext(ctx, `
-		SELECT order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
-		FROM orders WHERE order_uid = $1`, orderUID).
-		Scan(&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature, &order.CustomerID, &order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard)
+	err := scanOrder(c.db.QueryRowContext(ctx, `
+		SELECT `+orderColumns+`
+		FROM orders WHERE order_uid = $1`, orderUID), order)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // Заказ не найден
@@ -124,17 +282,18 @@ func (c *DBClient) GetOrderFromDB(ctx context.Context, orderUID string) (*model.
 
 	// Загрузка информации об оплате
 	err = c.db.QueryRowContext(ctx, `
-		SELECT transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
+		SELECT transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee, `+refundedColumn+`
 		FROM payment WHERE order_uid = $1`, orderUID).
-		Scan(&order.Payment.Transaction, &order.Payment.RequestID, &order.Payment.Currency, &order.Payment.Provider, &order.Payment.Amount, &order.Payment.PaymentDt, &order.Payment.Bank, &order.Payment.DeliveryCost, &order.Payment.GoodsTotal, &order.Payment.CustomFee)
+		Scan(&order.Payment.Transaction, &order.Payment.RequestID, &order.Payment.Currency, &order.Payment.Provider, &order.Payment.Amount, &order.Payment.PaymentDt, &order.Payment.Bank, &order.Payment.DeliveryCost, &order.Payment.GoodsTotal, &order.Payment.CustomFee, &order.Payment.Refunded)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при получении оплаты: %w", err)
 	}
 
 	// Загрузка товаров
 	rows, err := c.db.QueryContext(ctx, `
-		SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
-		FROM items WHERE order_uid = $1`, orderUID)
+		SELECT line_no, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
+		FROM items WHERE order_uid = $1
+		ORDER BY line_no`, orderUID)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при получении товаров: %w", err)
 	}
@@ -142,7 +301,7 @@ func (c *DBClient) GetOrderFromDB(ctx context.Context, orderUID string) (*model.
 
 	for rows.Next() {
 		item := model.Item{OrderUID: orderUID}
-		if err := rows.Scan(&item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid, &item.Name, &item.Sale, &item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status); err != nil {
+		if err := rows.Scan(&item.LineNo, &item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid, &item.Name, &item.Sale, &item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status); err != nil {
 			return nil, fmt.Errorf("ошибка при сканировании товара: %w", err)
 		}
 		order.Items = append(order.Items, item)
@@ -155,43 +314,80 @@ func (c *DBClient) GetOrderFromDB(ctx context.Context, orderUID string) (*model.
 	return order, nil
 }
 
-// GetAllOrders загружает все заказы из БД. Используется для восстановления кеша.
-func (c *DBClient) GetAllOrders(ctx context.Context) ([]*model.Order, error) {
-	var orders []*model.Order
+// OrderScan задает набор заказов для ForEachOrderBatch.
+type OrderScan struct {
+	Since     time.Time // только заказы с date_created >= Since; нулевое значение - без ограничения
+	Limit     int       // не больше Limit заказов; 0 - без ограничения
+	BatchSize int       // размер пачки; 0 - DefaultListLimit
+}
 
-	// Загружаем все order_uid из таблицы orders
-	rows, err := c.db.QueryContext(ctx, `SELECT order_uid FROM orders`)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка при получении списка заказов: %w", err)
+// ForEachOrderBatch передает заказы в fn пачками, от новых к старым по date_created.
+// Каждая пачка загружается четырьмя запросами (keyset-пагинация по (date_created, order_uid)
+// и догрузка доставки, оплат и товаров через ANY), поэтому память ограничена
+// размером пачки, а число запросов не зависит от числа заказов в пачке.
+// Ошибка fn прерывает обход и возвращается вызывающему.
+func (c *DBClient) ForEachOrderBatch(ctx context.Context, scan OrderScan, fn func([]*model.Order) error) error {
+	batchSize := scan.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultListLimit
 	}
-	defer rows.Close()
 
-	var orderUIDs []string
-	for rows.Next() {
-		var orderUID string
-		if err := rows.Scan(&orderUID); err != nil {
-			return nil, fmt.Errorf("ошибка при сканировании order_uid: %w", err)
+	var (
+		lastCreated time.Time
+		lastUID     string
+		total       int
+	)
+	for {
+		size := batchSize
+		if scan.Limit > 0 && scan.Limit-total < size {
+			size = scan.Limit - total
+		}
+		if size <= 0 {
+			return nil
 		}
-		orderUIDs = append(orderUIDs, orderUID)
-	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("ошибка итерации по заказам: %w", err)
-	}
+		// Первая пачка начинается с самых новых заказов, следующие - после последнего прочитанного.
+		args := []interface{}{size}
+		var conds []string
+		if !scan.Since.IsZero() {
+			args = append(args, scan.Since)
+			conds = append(conds, fmt.Sprintf("date_created >= $%d", len(args)))
+		}
+		if lastUID != "" {
+			args = append(args, lastCreated, lastUID)
+			conds = append(conds, fmt.Sprintf("(date_created, order_uid) < ($%d, $%d)", len(args)-1, len(args)))
+		}
+		query := `SELECT ` + orderColumns + ` FROM orders`
+		if len(conds) > 0 {
+			query += " WHERE " + strings.Join(conds, " AND ")
+		}
+		query += " ORDER BY date_created DESC, order_uid DESC LIMIT $1"
 
-	// Загружаем полную информацию для каждого заказа
-	for _, orderUID := range orderUIDs {
-		order, err := c.GetOrderFromDB(ctx, orderUID)
+		orders, err := c.queryOrderHeaders(ctx, query, args...)
 		if err != nil {
-			log.Printf("Ошибка при загрузке заказа %s: %v", orderUID, err)
-			continue // Пропускаем проблемный заказ
+			return err
+		}
+		if len(orders) == 0 {
+			return nil
 		}
-		if order != nil {
-			orders = append(orders, order)
+		if err := c.loadOrderDetails(ctx, orders); err != nil {
+			return err
 		}
+		if err := fn(orders); err != nil {
+			return err
+		}
+		total += len(orders)
+		if len(orders) < size {
+			return nil
+		}
+		last := orders[len(orders)-1]
+		lastCreated, lastUID = last.DateCreated, last.OrderUID
 	}
+}
 
-	return orders, nil
+// scanOrder сканирует столбцы orderColumns в order.
+func scanOrder(row interface{ Scan(...interface{}) error }, order *model.Order) error {
+	return row.Scan(&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature, &order.CustomerID, &order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard, &order.Version, &order.UpdatedAt, &order.Status)
 }
 
 // helper
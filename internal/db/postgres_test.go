@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/model/modeltest"
+)
+
+// testDB подключается к БД из TEST_DATABASE_URL и применяет миграции;
+// без переменной тест пропускается.
+func testDB(t *testing.T) *DBClient {
+	t.Helper()
+	connStr := os.Getenv("TEST_DATABASE_URL")
+	if connStr == "" {
+		t.Skip("TEST_DATABASE_URL не задан")
+	}
+	c, err := NewDBClient(connStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if _, err := c.MigrateUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSaveOrder_UnchangedSince(t *testing.T) {
+	c := testDB(t)
+	ctx := context.Background()
+
+	order := modeltest.Order()
+	order.OrderUID = fmt.Sprintf("unchanged-since-%d", time.Now().UnixNano())
+	order.Payment.Transaction = order.OrderUID
+	if err := c.SaveOrder(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+
+	// Сообщение ждало повтора с момента до сохранения заказа: заказ с тех пор изменен.
+	retried := modeltest.Order()
+	retried.OrderUID, retried.Payment.Transaction = order.OrderUID, order.OrderUID
+	retried.Delivery.City = "Haifa"
+	retried.UnchangedSince = order.UpdatedAt.Add(-time.Second)
+	if err := c.SaveOrder(ctx, retried); !errors.Is(err, ErrStaleVersion) {
+		t.Fatalf("Ожидалась ошибка ErrStaleVersion, получено %v", err)
+	}
+
+	retried.UnchangedSince = order.UpdatedAt
+	if err := c.SaveOrder(ctx, retried); err != nil {
+		t.Fatalf("Заказ не менялся после UnchangedSince, получена ошибка %v", err)
+	}
+	if retried.Version != order.Version+1 {
+		t.Errorf("Ожидалась версия %d, получена %d", order.Version+1, retried.Version)
+	}
+	if !order.Created || retried.Created {
+		t.Errorf("Ожидалось created=true для нового заказа и false для замены, получено %v и %v", order.Created, retried.Created)
+	}
+}
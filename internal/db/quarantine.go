@@ -0,0 +1,262 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/model"
+	"github.com/112Alex/demo-service.git/internal/rules"
+)
+
+// QuarantineStatus - состояние заказа в карантине.
+type QuarantineStatus string
+
+const (
+	QuarantinePending  QuarantineStatus = "pending"  // ожидает проверки
+	QuarantineApproved QuarantineStatus = "approved" // одобрен и перенесен в основные таблицы
+	QuarantineRejected QuarantineStatus = "rejected" // отклонен
+)
+
+var (
+	// ErrQuarantineNotFound возвращается, если записи карантина с таким id нет.
+	ErrQuarantineNotFound = errors.New("заказ в карантине не найден")
+	// ErrQuarantineReviewed возвращается при повторном одобрении или отклонении заказа.
+	ErrQuarantineReviewed = errors.New("заказ в карантине уже проверен")
+)
+
+// QuarantinedOrder - заказ, отложенный до ручной проверки из-за нарушения бизнес-правил.
+type QuarantinedOrder struct {
+	ID         int64            `json:"id"`
+	Order      *model.Order     `json:"order"`
+	Violations rules.Violations `json:"violations"`
+	Status     QuarantineStatus `json:"status"`
+	CreatedAt  time.Time        `json:"created_at"`
+	ReviewedAt *time.Time       `json:"reviewed_at,omitempty"`
+	ReviewNote string           `json:"review_note,omitempty"`
+	// BaseVersion - версия сохраненного заказа на момент помещения в карантин
+	// (0 - заказа не было); nil для записей, созданных до появления проверки.
+	BaseVersion *int64 `json:"base_version,omitempty"`
+}
+
+// QuarantineFilter описывает фильтры ListQuarantine. Пустые поля не участвуют в фильтрации.
+type QuarantineFilter struct {
+	Status   QuarantineStatus
+	OrderUID string
+	Limit    int // 0 - DefaultListLimit, не больше MaxListLimit
+}
+
+// quarantineColumns - столбцы таблицы quarantine в порядке, ожидаемом scanQuarantined.
+const quarantineColumns = `id, payload, violations, status, created_at, reviewed_at, review_note, base_version`
+
+// QuarantineOrder помещает заказ в карантин вместо основных таблиц и возвращает id записи.
+// Ключ идемпотентности записывается в журнал processed_messages в той же транзакции,
+// поэтому повторно полученное сообщение дает ErrDuplicate и не создает вторую запись.
+// Запоминается текущая версия сохраненного заказа, см. ApproveQuarantined.
+func (c *DBClient) QuarantineOrder(ctx context.Context, order *model.Order, violations rules.Violations) (int64, error) {
+	payload, err := json.Marshal(order)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось сериализовать заказ %s: %w", order.OrderUID, err)
+	}
+	reasons, err := json.Marshal(violations)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось сериализовать нарушения заказа %s: %w", order.OrderUID, err)
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось начать транзакцию: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := claimIdempotencyKey(ctx, tx, order.IdempotencyKey, order.OrderUID); err != nil {
+		return 0, err
+	}
+	var baseVersion int64
+	err = tx.QueryRowContext(ctx, `SELECT version FROM orders WHERE order_uid = $1`, order.OrderUID).Scan(&baseVersion)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("не удалось получить версию заказа %s: %w", order.OrderUID, err)
+	}
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO quarantine (order_uid, idempotency_key, payload, violations, base_version)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+		RETURNING id`,
+		order.OrderUID, order.IdempotencyKey, payload, reasons, baseVersion).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось поместить заказ %s в карантин: %w", order.OrderUID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("не удалось поместить заказ %s в карантин: %w", order.OrderUID, err)
+	}
+	return id, nil
+}
+
+// ListQuarantine возвращает записи карантина, от новых к старым.
+func (c *DBClient) ListQuarantine(ctx context.Context, f QuarantineFilter) ([]*QuarantinedOrder, error) {
+	limit := f.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT `+quarantineColumns+`
+		FROM quarantine
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR order_uid = $2)
+		ORDER BY id DESC LIMIT $3`,
+		string(f.Status), f.OrderUID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении карантина: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*QuarantinedOrder
+	for rows.Next() {
+		q, err := scanQuarantined(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка итерации по карантину: %w", err)
+	}
+	return out, nil
+}
+
+// GetQuarantined возвращает запись карантина по id или ErrQuarantineNotFound.
+func (c *DBClient) GetQuarantined(ctx context.Context, id int64) (*QuarantinedOrder, error) {
+	q, err := scanQuarantined(c.db.QueryRowContext(ctx, `SELECT `+quarantineColumns+` FROM quarantine WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: id %d", ErrQuarantineNotFound, id)
+	}
+	return q, err
+}
+
+// ApproveQuarantined переносит заказ из карантина в основные таблицы так же, как SaveOrder
+// (включая событие OrderStored в outbox), и отмечает запись одобренной.
+// Ключ идемпотентности заказа уже записан при помещении в карантин и повторно не проверяется.
+// Возвращает сохраненный заказ. Если сохраненный заказ изменился после помещения в карантин
+// или сохранена более новая версия, возвращает ErrStaleVersion: одобрение не должно
+// затирать более свежие данные.
+func (c *DBClient) ApproveQuarantined(ctx context.Context, id int64, note string) (*model.Order, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %w", err)
+	}
+	defer tx.Rollback()
+
+	q, err := lockPendingQuarantined(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	order := q.Order
+	if q.BaseVersion != nil {
+		current, _, err := lockOrderVersion(ctx, tx, order.OrderUID)
+		if err != nil {
+			return nil, err
+		}
+		if current != *q.BaseVersion {
+			return nil, fmt.Errorf("%w: заказ %s изменен после помещения в карантин (версия %d, была %d)",
+				ErrStaleVersion, order.OrderUID, current, *q.BaseVersion)
+		}
+	}
+	stored, err := saveOrderTx(ctx, tx, order)
+	if err != nil {
+		return nil, err
+	}
+	if err := copyItems(ctx, tx, []*model.Order{stored}); err != nil {
+		return nil, err
+	}
+	if err := insertOrderStored(ctx, tx, []*model.Order{stored}); err != nil {
+		return nil, err
+	}
+	if err := reviewQuarantined(ctx, tx, id, QuarantineApproved, note); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось зафиксировать одобрение заказа: %w", err)
+	}
+	return stored, nil
+}
+
+// RejectQuarantined отмечает запись карантина отклоненной; заказ не сохраняется.
+func (c *DBClient) RejectQuarantined(ctx context.Context, id int64, note string) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("не удалось начать транзакцию: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := lockPendingQuarantined(ctx, tx, id); err != nil {
+		return err
+	}
+	if err := reviewQuarantined(ctx, tx, id, QuarantineRejected, note); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockPendingQuarantined блокирует запись карантина до конца транзакции.
+// Уже проверенная запись дает ErrQuarantineReviewed.
+func lockPendingQuarantined(ctx context.Context, tx *sql.Tx, id int64) (*QuarantinedOrder, error) {
+	q, err := scanQuarantined(tx.QueryRowContext(ctx, `SELECT `+quarantineColumns+` FROM quarantine WHERE id = $1 FOR UPDATE`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: id %d", ErrQuarantineNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if q.Status != QuarantinePending {
+		return nil, fmt.Errorf("%w: id %d, статус %s", ErrQuarantineReviewed, id, q.Status)
+	}
+	return q, nil
+}
+
+func reviewQuarantined(ctx context.Context, tx *sql.Tx, id int64, status QuarantineStatus, note string) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE quarantine SET status = $2, reviewed_at = now(), review_note = $3 WHERE id = $1`,
+		id, string(status), note)
+	if err != nil {
+		return fmt.Errorf("не удалось обновить запись карантина %d: %w", id, err)
+	}
+	return nil
+}
+
+// scanQuarantined сканирует столбцы quarantineColumns. sql.ErrNoRows возвращается без обертки.
+func scanQuarantined(row interface{ Scan(...interface{}) error }) (*QuarantinedOrder, error) {
+	var (
+		q                   QuarantinedOrder
+		payload, violations []byte
+		status              string
+		reviewedAt          sql.NullTime
+		baseVersion         sql.NullInt64
+	)
+	err := row.Scan(&q.ID, &payload, &violations, &status, &q.CreatedAt, &reviewedAt, &q.ReviewNote, &baseVersion)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при сканировании записи карантина: %w", err)
+	}
+	q.Status = QuarantineStatus(status)
+	if reviewedAt.Valid {
+		q.ReviewedAt = &reviewedAt.Time
+	}
+	if baseVersion.Valid {
+		q.BaseVersion = &baseVersion.Int64
+	}
+	if err := json.Unmarshal(payload, &q.Order); err != nil {
+		return nil, fmt.Errorf("некорректный заказ в записи карантина %d: %w", q.ID, err)
+	}
+	if err := json.Unmarshal(violations, &q.Violations); err != nil {
+		return nil, fmt.Errorf("некорректные нарушения в записи карантина %d: %w", q.ID, err)
+	}
+	return &q, nil
+}
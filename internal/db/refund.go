@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/model"
+)
+
+// ErrRefundExceedsPayment возвращается RecordRefund, если сумма возвратов превысила бы сумму оплаты.
+var ErrRefundExceedsPayment = errors.New("сумма возвратов превышает сумму оплаты")
+
+// refundedColumn - сумма возвратов заказа для запросов к таблице payment.
+const refundedColumn = `(SELECT COALESCE(SUM(r.amount), 0) FROM payment_refunds r WHERE r.order_uid = payment.order_uid)`
+
+// RecordRefund записывает возврат оплаты заказа и возвращает новую сумму возвратов.
+// Ключ идемпотентности refund.IdempotencyKey записывается в той же транзакции,
+// поэтому повторно полученное событие дает ErrDuplicate.
+// Если заказа нет, возвращается ErrOrderNotFound.
+func (c *DBClient) RecordRefund(ctx context.Context, refund *model.Refund) (int, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось начать транзакцию: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := claimIdempotencyKey(ctx, tx, refund.IdempotencyKey, refund.OrderUID); err != nil {
+		return 0, err
+	}
+
+	// Блокировка оплаты упорядочивает параллельные возвраты одного заказа.
+	var amount int
+	err = tx.QueryRowContext(ctx, `SELECT amount FROM payment WHERE order_uid = $1 FOR UPDATE`, refund.OrderUID).Scan(&amount)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w: %s", ErrOrderNotFound, refund.OrderUID)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("не удалось заблокировать оплату: %w", err)
+	}
+	// Сумма возвратов читается отдельным запросом: в READ COMMITTED снимок запроса
+	// берется до ожидания блокировки, и подзапрос в SELECT ... FOR UPDATE не увидел бы
+	// возврат, зафиксированный транзакцией, которая держала блокировку.
+	var refunded int
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(SUM(amount), 0) FROM payment_refunds WHERE order_uid = $1`, refund.OrderUID).Scan(&refunded)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось получить сумму возвратов: %w", err)
+	}
+	if refunded+refund.Amount > amount {
+		return 0, fmt.Errorf("%w: заказ %s, оплачено %d, возвращено %d, возврат %d", ErrRefundExceedsPayment, refund.OrderUID, amount, refunded, refund.Amount)
+	}
+
+	occurredAt := refund.OccurredAt
+	if occurredAt.IsZero() {
+		occurredAt = time.Now()
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO payment_refunds (order_uid, refund_id, amount, reason, occurred_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		refund.OrderUID, refund.RefundID, refund.Amount, refund.Reason, occurredAt)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось записать возврат заказа %s: %w", refund.OrderUID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("не удалось зафиксировать возврат: %w", err)
+	}
+	return refunded + refund.Amount, nil
+}
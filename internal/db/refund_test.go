@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/model"
+	"github.com/112Alex/demo-service.git/internal/model/modeltest"
+)
+
+func TestRecordRefund_Concurrent(t *testing.T) {
+	c := testDB(t)
+	ctx := context.Background()
+
+	order := modeltest.Order()
+	order.OrderUID = fmt.Sprintf("refund-race-%d", time.Now().UnixNano())
+	order.Payment.Transaction = order.OrderUID
+	if err := c.SaveOrder(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+
+	// Оплата заблокирована, пока оба возврата не начнут ее ждать: так второй
+	// возврат гарантированно получает блокировку после фиксации первого.
+	lock, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Rollback()
+	if _, err := lock.ExecContext(ctx, `SELECT 1 FROM payment WHERE order_uid = $1 FOR UPDATE`, order.OrderUID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Каждый возврат меньше оплаты, но вместе они ее превышают.
+	amount := order.Payment.Amount/2 + 1
+	errs := make(chan error, 2)
+	for i := range 2 {
+		go func() {
+			_, err := c.RecordRefund(ctx, &model.Refund{
+				OrderUID:       order.OrderUID,
+				RefundID:       fmt.Sprintf("%s-%d", order.OrderUID, i),
+				Amount:         amount,
+				IdempotencyKey: fmt.Sprintf("refund_id:%s-%d", order.OrderUID, i),
+			})
+			errs <- err
+		}()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var waiting int
+		err := c.db.QueryRowContext(ctx, `
+			SELECT count(*) FROM pg_stat_activity
+			WHERE datname = current_database() AND wait_event_type = 'Lock'`).Scan(&waiting)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if waiting >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Ожидалось, что оба возврата ждут блокировку, ждут %d", waiting)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := lock.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var recorded, exceeded int
+	for range 2 {
+		switch err := <-errs; {
+		case err == nil:
+			recorded++
+		case errors.Is(err, ErrRefundExceedsPayment):
+			exceeded++
+		default:
+			t.Fatalf("Неожиданная ошибка: %v", err)
+		}
+	}
+	if recorded != 1 || exceeded != 1 {
+		t.Errorf("Ожидался один записанный и один отклоненный возврат, записано %d, отклонено %d", recorded, exceeded)
+	}
+}
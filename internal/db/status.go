@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/112Alex/demo-service.git/internal/model"
+)
+
+var (
+	// ErrOrderNotFound возвращается UpdateOrderStatus, если заказа нет в БД.
+	ErrOrderNotFound = errors.New("заказ не найден")
+	// ErrInvalidTransition возвращается UpdateOrderStatus для перехода, запрещенного
+	// жизненным циклом заказа (см. model.OrderStatus.CanTransition).
+	ErrInvalidTransition = errors.New("недопустимый переход статуса заказа")
+)
+
+// UpdateOrderStatus переводит заказ в статус upd.Status и записывает переход в историю.
+// Статусы не повторяются в жизненном цикле заказа, поэтому переход в уже пройденный
+// статус (повторно полученное событие) дает ErrDuplicate и не меняет БД.
+// Версия заказа не меняется: она относится к содержимому заказа, а не к его статусу.
+// Возвращает записанный переход; RecordedAt совпадает с новым updated_at заказа.
+func (c *DBClient) UpdateOrderStatus(ctx context.Context, upd *model.StatusUpdate) (*model.StatusChange, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось начать транзакцию: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current model.OrderStatus
+	err = tx.QueryRowContext(ctx, `SELECT status FROM orders WHERE order_uid = $1 FOR UPDATE`, upd.OrderUID).Scan(&current)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrOrderNotFound, upd.OrderUID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("не удалось заблокировать заказ: %w", err)
+	}
+
+	if !current.CanTransition(upd.Status) {
+		var seen bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM order_status_history WHERE order_uid = $1 AND to_status = $2)`,
+			upd.OrderUID, string(upd.Status)).Scan(&seen)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при проверке истории статусов: %w", err)
+		}
+		if seen {
+			return nil, fmt.Errorf("%w: заказ %s уже был в статусе %s", ErrDuplicate, upd.OrderUID, upd.Status)
+		}
+		return nil, fmt.Errorf("%w: заказ %s, %s -> %s", ErrInvalidTransition, upd.OrderUID, current, upd.Status)
+	}
+
+	change := &model.StatusChange{From: current, To: upd.Status, Reason: upd.Reason, OccurredAt: upd.OccurredAt}
+	err = tx.QueryRowContext(ctx, `
+		UPDATE orders SET status = $2, updated_at = now() WHERE order_uid = $1
+		RETURNING updated_at`,
+		upd.OrderUID, string(upd.Status)).Scan(&change.RecordedAt)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось обновить статус заказа: %w", err)
+	}
+	if change.OccurredAt.IsZero() {
+		change.OccurredAt = change.RecordedAt
+	}
+	if err := insertStatusChange(ctx, tx, upd.OrderUID, *change); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("не удалось зафиксировать статус заказа: %w", err)
+	}
+	return change, nil
+}
+
+// insertStatusChange записывает переход статуса заказа в историю в рамках транзакции tx.
+func insertStatusChange(ctx context.Context, tx *sql.Tx, orderUID string, change model.StatusChange) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO order_status_history (order_uid, from_status, to_status, reason, occurred_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5)`,
+		orderUID, string(change.From), string(change.To), change.Reason, change.OccurredAt)
+	if err != nil {
+		return fmt.Errorf("не удалось записать историю статусов заказа %s: %w", orderUID, err)
+	}
+	return nil
+}
+
+// GetStatusHistory возвращает историю статусов заказа в порядке записи.
+// Для несуществующего заказа возвращает nil: история каждого заказа начинается с его создания.
+func (c *DBClient) GetStatusHistory(ctx context.Context, orderUID string) ([]model.StatusChange, error) {
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT COALESCE(from_status, ''), to_status, reason, occurred_at, recorded_at
+		FROM order_status_history WHERE order_uid = $1
+		ORDER BY id`, orderUID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении истории статусов: %w", err)
+	}
+	defer rows.Close()
+
+	var history []model.StatusChange
+	for rows.Next() {
+		var (
+			ch       model.StatusChange
+			from, to string
+		)
+		if err := rows.Scan(&from, &to, &ch.Reason, &ch.OccurredAt, &ch.RecordedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании истории статусов: %w", err)
+		}
+		ch.From, ch.To = model.OrderStatus(from), model.OrderStatus(to)
+		history = append(history, ch)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка итерации по истории статусов: %w", err)
+	}
+	return history, nil
+}
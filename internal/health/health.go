@@ -0,0 +1,75 @@
+package health
+
+import "sync"
+
+// Status is the state of a component or of the whole service.
+type Status string
+
+const (
+	StatusUp       Status = "up"
+	StatusDegraded Status = "degraded"
+	StatusDown     Status = "down"
+)
+
+// Report describes the health of a single component.
+type Report struct {
+	Status  Status      `json:"status"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// Checker is implemented by components that report their health.
+type Checker interface {
+	Health() Report
+}
+
+// CheckerFunc adapts a function to Checker.
+type CheckerFunc func() Report
+
+// Health implements Checker.
+func (f CheckerFunc) Health() Report { return f() }
+
+// Registry collects named health checks. It is safe for concurrent use.
+type Registry struct {
+	mu     sync.RWMutex
+	checks map[string]Checker
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{checks: make(map[string]Checker)}
+}
+
+// Register adds or replaces a named check.
+func (r *Registry) Register(name string, c Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = c
+}
+
+// Check runs all checks. The overall status is the worst component status.
+func (r *Registry) Check() (Status, map[string]Report) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	overall := StatusUp
+	reports := make(map[string]Report, len(r.checks))
+	for name, c := range r.checks {
+		rep := c.Health()
+		reports[name] = rep
+		if severity(rep.Status) > severity(overall) {
+			overall = rep.Status
+		}
+	}
+	return overall, reports
+}
+
+func severity(s Status) int {
+	switch s {
+	case StatusUp:
+		return 0
+	case StatusDegraded:
+		return 1
+	default:
+		return 2
+	}
+}
@@ -0,0 +1,25 @@
+package health
+
+import "testing"
+
+func TestRegistry_WorstStatusWins(t *testing.T) {
+	r := NewRegistry()
+	if status, _ := r.Check(); status != StatusUp {
+		t.Errorf("Пустой реестр: ожидался %s, получен %s", StatusUp, status)
+	}
+
+	r.Register("db", CheckerFunc(func() Report { return Report{Status: StatusUp} }))
+	r.Register("warmup", CheckerFunc(func() Report { return Report{Status: StatusDegraded} }))
+	status, reports := r.Check()
+	if status != StatusDegraded {
+		t.Errorf("Ожидался %s, получен %s", StatusDegraded, status)
+	}
+	if len(reports) != 2 {
+		t.Errorf("Ожидалось 2 отчета, получено %d", len(reports))
+	}
+
+	r.Register("kafka", CheckerFunc(func() Report { return Report{Status: StatusDown} }))
+	if status, _ := r.Check(); status != StatusDown {
+		t.Errorf("Ожидался %s, получен %s", StatusDown, status)
+	}
+}
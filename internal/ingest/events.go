@@ -0,0 +1,212 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/model"
+)
+
+// Event types accepted on the orders topic. The type is taken from the
+// x-event-type message header or from a model.EventEnvelope around the payload.
+const (
+	EventOrderCreated       = "OrderCreated"       // payload: model.Order
+	EventOrderUpdated       = "OrderUpdated"       // payload: model.Order
+	EventOrderCancelled     = "OrderCancelled"     // payload: order_uid, reason, occurred_at
+	EventOrderStatusUpdated = "OrderStatusUpdated" // payload: model.StatusUpdate
+	EventPaymentRefunded    = "PaymentRefunded"    // payload: model.Refund
+
+	// EventOrder is the type of a bare order sent without an envelope or header.
+	EventOrder = "Order"
+)
+
+// eventSchemaVersion is the only supported envelope version. A missing version means 1.
+const eventSchemaVersion = 1
+
+// Event is a decoded message of the orders topic.
+type Event struct {
+	Type     string
+	OrderUID string
+	// Order is set for order events, which may be stored in batches with StoreBatch.
+	Order *model.Order
+
+	apply func(ctx context.Context) error
+}
+
+// Apply applies the event. Like Store, it returns db.ErrDuplicate, db.ErrStaleVersion or
+// ErrQuarantined when the event is deliberately not applied.
+func (e *Event) Apply(ctx context.Context) error {
+	return e.apply(ctx)
+}
+
+// eventMeta describes the message carrying an event.
+type eventMeta struct {
+	occurredAt time.Time // envelope time, used when the payload does not carry its own
+	source     string    // message position, see DecodeEvent
+}
+
+// eventDecoder decodes the payload of one event type.
+type eventDecoder func(s *Service, payload []byte, meta eventMeta) (*Event, error)
+
+var eventDecoders = map[string]eventDecoder{
+	EventOrder:              decodeOrderEvent,
+	EventOrderCreated:       decodeOrderEvent,
+	EventOrderUpdated:       decodeOrderEvent,
+	EventOrderCancelled:     decodeCancelledEvent,
+	EventOrderStatusUpdated: decodeStatusEvent,
+	EventPaymentRefunded:    decodeRefundEvent,
+}
+
+// KnownEvent reports whether events of the given type are accepted on the orders topic.
+func KnownEvent(eventType string) bool {
+	_, ok := eventDecoders[eventType]
+	return ok
+}
+
+// DecodeEvent decodes a message of the orders topic. eventType is the value of the
+// x-event-type header; when it is empty the payload is either an envelope or a bare order.
+// source identifies the message, e.g. "orders/0/42" for the Kafka topic, partition and
+// offset where it was first consumed; it must stay the same across redeliveries, retries
+// and replays of the message, since KeyMessage and refunds without refund_id are keyed
+// by it. The returned event is never nil: on error it carries only the type.
+func (s *Service) DecodeEvent(eventType string, data []byte, source string) (*Event, error) {
+	payload := data
+	meta := eventMeta{source: source}
+	if eventType == "" {
+		eventType = EventOrder
+		if env, ok := parseEnvelope(data); ok {
+			if env.Version != 0 && env.Version != eventSchemaVersion {
+				return &Event{Type: env.Type}, fmt.Errorf("%w %s: неподдерживаемая версия %d", ErrInvalidEvent, env.Type, env.Version)
+			}
+			eventType, payload, meta.occurredAt = env.Type, env.Payload, env.OccurredAt
+		}
+	}
+
+	decode, ok := eventDecoders[eventType]
+	if !ok {
+		return &Event{Type: eventType}, fmt.Errorf("%w: неизвестный тип события %q", ErrInvalidEvent, eventType)
+	}
+	ev, err := decode(s, payload, meta)
+	if err != nil {
+		return &Event{Type: eventType}, err
+	}
+	ev.Type = eventType
+	return ev, nil
+}
+
+// parseEnvelope recognizes an envelope by its type and payload fields, which orders do not have.
+func parseEnvelope(data []byte) (*model.EventEnvelope, bool) {
+	var env model.EventEnvelope
+	if err := json.Unmarshal(data, &env); err != nil || env.Type == "" || len(env.Payload) == 0 {
+		return nil, false
+	}
+	return &env, true
+}
+
+func decodeOrderEvent(s *Service, payload []byte, meta eventMeta) (*Event, error) {
+	order, err := s.decode(payload, meta.source)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{
+		OrderUID: order.OrderUID,
+		Order:    order,
+		apply:    func(ctx context.Context) error { return s.Store(ctx, order) },
+	}, nil
+}
+
+func decodeCancelledEvent(s *Service, payload []byte, meta eventMeta) (*Event, error) {
+	upd, err := model.DecodeCancellation(payload, s.opts.Strict)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrInvalidEvent, EventOrderCancelled, err)
+	}
+	return statusEvent(s, upd, meta.occurredAt), nil
+}
+
+func decodeStatusEvent(s *Service, payload []byte, meta eventMeta) (*Event, error) {
+	upd, err := model.DecodeStatusUpdate(payload, s.opts.Strict)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrInvalidEvent, EventOrderStatusUpdated, err)
+	}
+	return statusEvent(s, upd, meta.occurredAt), nil
+}
+
+func statusEvent(s *Service, upd *model.StatusUpdate, occurredAt time.Time) *Event {
+	if upd.OccurredAt.IsZero() {
+		upd.OccurredAt = occurredAt
+	}
+	return &Event{
+		OrderUID: upd.OrderUID,
+		apply:    func(ctx context.Context) error { return s.ApplyStatus(ctx, upd) },
+	}
+}
+
+// decodeRefundEvent keys a refund by its refund_id or else by the message that
+// carried it: partial refunds of the same amount are indistinguishable by content.
+// The source is the original position of the message, so a refund recorded before
+// its message went through a retry tier or the DLQ is not recorded again.
+func decodeRefundEvent(s *Service, payload []byte, meta eventMeta) (*Event, error) {
+	refund, err := model.DecodeRefund(payload, s.opts.Strict)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrInvalidEvent, EventPaymentRefunded, err)
+	}
+	if refund.OccurredAt.IsZero() {
+		refund.OccurredAt = meta.occurredAt
+	}
+	switch {
+	case refund.RefundID != "":
+		refund.IdempotencyKey = "refund_id:" + refund.RefundID
+	case meta.source != "":
+		refund.IdempotencyKey = "message:" + meta.source
+	default:
+		return nil, fmt.Errorf("%w %s: не задан refund_id", ErrInvalidEvent, EventPaymentRefunded)
+	}
+	return &Event{
+		OrderUID: refund.OrderUID,
+		apply:    func(ctx context.Context) error { return s.RecordRefund(ctx, refund) },
+	}, nil
+}
+
+// ApplyStatus changes the order status and updates the cached order, if any.
+// An already applied update returns db.ErrDuplicate.
+func (s *Service) ApplyStatus(ctx context.Context, upd *model.StatusUpdate) error {
+	change, err := s.saver.UpdateOrderStatus(ctx, upd)
+	if err != nil {
+		return err
+	}
+	log.Printf("Статус заказа %s изменен: %s -> %s", upd.OrderUID, change.From, change.To)
+
+	s.updateCached(upd.OrderUID, func(o *model.Order) {
+		o.Status = change.To
+		o.UpdatedAt = change.RecordedAt
+	})
+	return nil
+}
+
+// RecordRefund records a payment refund and updates the refunded total of the cached order, if any.
+// An already recorded refund returns db.ErrDuplicate.
+func (s *Service) RecordRefund(ctx context.Context, refund *model.Refund) error {
+	total, err := s.saver.RecordRefund(ctx, refund)
+	if err != nil {
+		return err
+	}
+	log.Printf("Возврат по заказу %s: %d, всего возвращено %d", refund.OrderUID, refund.Amount, total)
+
+	s.updateCached(refund.OrderUID, func(o *model.Order) { o.Payment.Refunded = total })
+	return nil
+}
+
+// updateCached replaces the cached order, if any, with an updated copy:
+// cached orders are shared with readers and must not be modified in place.
+func (s *Service) updateCached(orderUID string, update func(o *model.Order)) {
+	cached, ok := s.cache.Get(orderUID)
+	if !ok {
+		return
+	}
+	updated := *cached
+	update(&updated)
+	s.cache.Set(orderUID, &updated)
+}
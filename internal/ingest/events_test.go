@@ -0,0 +1,121 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/112Alex/demo-service.git/internal/cache"
+	"github.com/112Alex/demo-service.git/internal/model"
+)
+
+func TestService_DecodeEvent(t *testing.T) {
+	order := orderJSON(t, nil)
+	tests := []struct {
+		name     string
+		header   string
+		payload  string
+		wantType string
+		wantErr  bool
+	}{
+		{"bare order", "", order, EventOrder, false},
+		{"envelope created", "", `{"type":"OrderCreated","version":1,"payload":` + order + `}`, EventOrderCreated, false},
+		{"envelope updated, no version", "", `{"type":"OrderUpdated","payload":` + order + `}`, EventOrderUpdated, false},
+		{"envelope cancelled", "", `{"type":"OrderCancelled","payload":{"order_uid":"1","reason":"customer"}}`, EventOrderCancelled, false},
+		{"envelope refund", "", `{"type":"PaymentRefunded","payload":{"order_uid":"1","amount":100}}`, EventPaymentRefunded, false},
+		{"header status", EventOrderStatusUpdated, `{"order_uid":"1","status":"paid"}`, EventOrderStatusUpdated, false},
+		{"header refund", EventPaymentRefunded, `{"order_uid":"1","amount":100}`, EventPaymentRefunded, false},
+		{"unknown type", "", `{"type":"OrderLost","payload":{"order_uid":"1"}}`, "OrderLost", true},
+		{"unsupported version", "", `{"type":"OrderCreated","version":2,"payload":` + order + `}`, EventOrderCreated, true},
+		{"invalid refund", "", `{"type":"PaymentRefunded","payload":{"order_uid":"1","amount":0}}`, EventPaymentRefunded, true},
+	}
+
+	s := NewService(&mockSaver{}, cache.NewCache(10, 0), Options{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, err := s.DecodeEvent(tt.header, []byte(tt.payload), "orders/0/0")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Ожидалась ошибка: %v, получено %v", tt.wantErr, err)
+			}
+			if ev.Type != tt.wantType {
+				t.Errorf("Ожидался тип %s, получен %s", tt.wantType, ev.Type)
+			}
+			if err == nil && ev.OrderUID != "1" {
+				t.Errorf("Ожидался заказ 1, получен %q", ev.OrderUID)
+			}
+		})
+	}
+}
+
+func TestService_ApplyStatus(t *testing.T) {
+	c := cache.NewCache(10, 0)
+	s := NewService(&mockSaver{}, c, Options{})
+	if res := s.Ingest(context.Background(), []byte(orderJSON(t, nil))); res.Status != StatusCreated {
+		t.Fatalf("Ожидался статус created, получен %s (%s)", res.Status, res.Error)
+	}
+	before, _ := c.Get("1")
+
+	ev, err := s.DecodeEvent(EventOrderStatusUpdated, []byte(`{"order_uid":"1","status":"paid"}`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ev.Apply(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := c.Get("1")
+	if after.Status != model.StatusPaid {
+		t.Errorf("Ожидался статус paid в кэше, получен %q", after.Status)
+	}
+	if before.Status == model.StatusPaid {
+		t.Error("Заказ в кэше должен заменяться копией, а не изменяться")
+	}
+
+	if _, err := s.DecodeEvent(EventOrderStatusUpdated, []byte(`{"order_uid":"1","status":"lost"}`), ""); !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("Ожидалась ErrInvalidEvent, получено %v", err)
+	}
+}
+
+func TestService_RecordRefund(t *testing.T) {
+	c := cache.NewCache(10, 0)
+	saver := &mockSaver{}
+	s := NewService(saver, c, Options{})
+	if res := s.Ingest(context.Background(), []byte(orderJSON(t, nil))); res.Status != StatusCreated {
+		t.Fatalf("Ожидался статус created, получен %s (%s)", res.Status, res.Error)
+	}
+
+	partial := `{"type":"PaymentRefunded","occurred_at":"2024-01-02T03:04:05Z","payload":{"order_uid":"1","amount":50}}`
+	for i, payload := range []string{
+		`{"type":"PaymentRefunded","payload":{"refund_id":"r1","order_uid":"1","amount":100}}`,
+		partial,
+		partial, // второй такой же частичный возврат в другом сообщении
+	} {
+		ev, err := s.DecodeEvent("", []byte(payload), fmt.Sprintf("orders/0/%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ev.Apply(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(saver.refunds) != 3 {
+		t.Fatalf("Ожидалось 3 возврата, получено %d", len(saver.refunds))
+	}
+	if key := saver.refunds[0].IdempotencyKey; key != "refund_id:r1" {
+		t.Errorf("Ожидался ключ по refund_id, получен %q", key)
+	}
+	if saver.refunds[1].IdempotencyKey == saver.refunds[2].IdempotencyKey {
+		t.Errorf("Одинаковые возвраты в разных сообщениях должны иметь разные ключи, получен %q", saver.refunds[1].IdempotencyKey)
+	}
+	if saver.refunds[1].OccurredAt.IsZero() {
+		t.Error("Время возврата должно браться из конверта")
+	}
+	if cached, _ := c.Get("1"); cached.Payment.Refunded != 200 {
+		t.Errorf("Ожидалась сумма возвратов 200 в кэше, получено %d", cached.Payment.Refunded)
+	}
+
+	if _, err := s.DecodeEvent(EventPaymentRefunded, []byte(`{"order_uid":"1","amount":50}`), ""); !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("Без refund_id и позиции сообщения ожидалась ErrInvalidEvent, получено %v", err)
+	}
+}
@@ -0,0 +1,324 @@
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/112Alex/demo-service.git/internal/cache"
+	"github.com/112Alex/demo-service.git/internal/db"
+	"github.com/112Alex/demo-service.git/internal/metrics"
+	"github.com/112Alex/demo-service.git/internal/model"
+	"github.com/112Alex/demo-service.git/internal/rules"
+)
+
+// OrderSaver persists orders. Implemented by *db.DBClient.
+type OrderSaver interface {
+	SaveOrder(ctx context.Context, order *model.Order) error
+	// SaveOrders persists a batch in one transaction; see db.DBClient.SaveOrders.
+	SaveOrders(ctx context.Context, orders []*model.Order) ([]error, error)
+	// QuarantineOrder holds an order for manual review; see db.DBClient.QuarantineOrder.
+	QuarantineOrder(ctx context.Context, order *model.Order, violations rules.Violations) (int64, error)
+	// UpdateOrderStatus applies a status change; see db.DBClient.UpdateOrderStatus.
+	UpdateOrderStatus(ctx context.Context, upd *model.StatusUpdate) (*model.StatusChange, error)
+	// RecordRefund records a payment refund; see db.DBClient.RecordRefund.
+	RecordRefund(ctx context.Context, refund *model.Refund) (int, error)
+}
+
+// Status is the outcome of ingesting a single order.
+type Status string
+
+const (
+	StatusCreated     Status = "created"
+	StatusUpdated     Status = "updated" // an existing order was replaced
+	StatusDuplicate   Status = "duplicate"
+	StatusStale       Status = "stale"
+	StatusQuarantined Status = "quarantined"
+	StatusInvalid     Status = "invalid"
+	StatusFailed      Status = "failed"
+)
+
+// KeyStrategy selects how the idempotency key of an incoming order is derived.
+type KeyStrategy string
+
+const (
+	// KeyContent hashes the order content, so an order sent twice by a producer is a
+	// duplicate, and so is an order changed back to content it had within the retention.
+	KeyContent KeyStrategy = "content"
+	// KeyMessage identifies a Kafka message by the position where it was first consumed,
+	// kept through retry tiers and DLQ replays: only deliveries of the same message are
+	// duplicates. HTTP requests, which have no position, fall back to KeyContent.
+	KeyMessage KeyStrategy = "message"
+	// KeyRequestID uses payment.request_id, falling back to KeyContent when it is empty.
+	KeyRequestID KeyStrategy = "request_id"
+)
+
+// Options configure a Service.
+type Options struct {
+	IdempotencyKey KeyStrategy   // defaults to KeyContent
+	Strict         bool          // reject payloads with unknown fields
+	Rules          *rules.Engine // business rules; nil disables them
+}
+
+// Result describes what happened to a single order.
+type Result struct {
+	OrderUID string                 `json:"order_uid,omitempty"`
+	Status   Status                 `json:"status"`
+	Error    string                 `json:"error,omitempty"`
+	Errors   model.ValidationErrors `json:"errors,omitempty"` // field errors of an invalid order
+	Rules    rules.Violations       `json:"rule_violations,omitempty"`
+}
+
+// ErrInvalidOrder wraps decoding and validation failures. Such orders must not be retried.
+// The wrapped error chain includes model.ValidationErrors with per-field details
+// or rules.Violations for orders breaking business rules.
+var ErrInvalidOrder = errors.New("некорректный заказ")
+
+// ErrInvalidEvent wraps decoding and validation failures of events other than orders.
+// Such events must not be retried. The wrapped error chain includes model.ValidationErrors.
+var ErrInvalidEvent = errors.New("некорректное событие")
+
+// ErrQuarantined is returned by Store for an order held for manual review instead of
+// being stored. The wrapped error chain includes the rules.Violations. Such orders
+// must not be retried.
+var ErrQuarantined = errors.New("заказ помещен в карантин")
+
+// Service implements the decode/validate/save/cache pipeline shared by
+// the Kafka consumer and the HTTP ingestion endpoint.
+type Service struct {
+	saver OrderSaver
+	cache *cache.Cache
+	opts  Options
+}
+
+// NewService creates an ingestion service.
+func NewService(saver OrderSaver, cache *cache.Cache, opts Options) *Service {
+	if opts.IdempotencyKey == "" {
+		opts.IdempotencyKey = KeyContent
+	}
+	return &Service{saver: saver, cache: cache, opts: opts}
+}
+
+// Decode parses and validates a JSON order and assigns its idempotency key.
+func (s *Service) Decode(data []byte) (*model.Order, error) {
+	return s.decode(data, "")
+}
+
+// decode implements Decode for a message identified by source, see idempotencyKey.
+func (s *Service) decode(data []byte, source string) (*model.Order, error) {
+	order, err := model.DecodeOrder(data, s.opts.Strict)
+	if err != nil {
+		metrics.IngestOrders.Add(string(StatusInvalid), 1)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOrder, err)
+	}
+	if err := s.Validate(order); err != nil {
+		metrics.IngestOrders.Add(string(StatusInvalid), 1)
+		return nil, err
+	}
+	// The refunded total is kept by PaymentRefunded events and loaded on save.
+	order.Payment.Refunded = 0
+	order.IdempotencyKey = s.idempotencyKey(order, source)
+	return order, nil
+}
+
+// idempotencyKey derives the key under which the order is recorded in the
+// processed-messages ledger. source identifies the message that carried the
+// order, see DecodeEvent; it is empty for HTTP requests.
+func (s *Service) idempotencyKey(order *model.Order, source string) string {
+	switch {
+	case s.opts.IdempotencyKey == KeyRequestID && order.Payment.RequestID != "":
+		return "request_id:" + order.Payment.RequestID
+	case s.opts.IdempotencyKey == KeyMessage && source != "":
+		return "message:" + source
+	default:
+		return contentKey(order)
+	}
+}
+
+// contentKey hashes a decoded message rather than its raw payload,
+// so formatting differences between producers do not matter.
+func contentKey(v interface{}) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Validate checks that the order can be stored: see model.Order.Validate,
+// then the business rules. Orders breaking rules of quarantine severity pass:
+// Store holds them for review.
+func (s *Service) Validate(order *model.Order) error {
+	if err := order.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidOrder, err)
+	}
+	return s.checkRules(order)
+}
+
+// checkRules evaluates business rules and rejects orders breaking rules of reject severity.
+// Warnings are logged and the order is accepted.
+func (s *Service) checkRules(order *model.Order) error {
+	if s.opts.Rules == nil {
+		return nil
+	}
+	violations := s.opts.Rules.Evaluate(order)
+	for _, v := range violations {
+		metrics.RuleViolations.Add(v.Rule, 1)
+	}
+
+	switch violations.Severity() {
+	case rules.SeverityReject:
+		return fmt.Errorf("%w: %w", ErrInvalidOrder, violations)
+	case rules.SeverityWarn:
+		log.Printf("Заказ %s принят с предупреждениями: %v", order.OrderUID, violations)
+	}
+	return nil
+}
+
+// quarantineViolations returns the violations if the order must be quarantined.
+// Rules are cheap and deterministic, so they are evaluated again here rather than
+// carrying the verdict of Validate on the order.
+func (s *Service) quarantineViolations(order *model.Order) rules.Violations {
+	if s.opts.Rules == nil {
+		return nil
+	}
+	violations := s.opts.Rules.Evaluate(order)
+	if violations.Severity() != rules.SeverityQuarantine {
+		return nil
+	}
+	return violations
+}
+
+// quarantine holds the order for review and returns ErrQuarantined on success.
+func (s *Service) quarantine(ctx context.Context, order *model.Order, violations rules.Violations) error {
+	id, err := s.saver.QuarantineOrder(ctx, order, violations)
+	if err != nil {
+		return err
+	}
+	log.Printf("Заказ %s помещен в карантин (id %d): %v", order.OrderUID, id, violations)
+	return fmt.Errorf("%w: %w", ErrQuarantined, violations)
+}
+
+// Store persists the order and puts it into the cache.
+// The cache is only updated with what was actually persisted: on db.ErrStaleVersion,
+// db.ErrDuplicate and ErrQuarantined it is left untouched, otherwise it receives
+// the order with its stored version.
+func (s *Service) Store(ctx context.Context, order *model.Order) error {
+	var err error
+	if violations := s.quarantineViolations(order); violations != nil {
+		err = s.quarantine(ctx, order, violations)
+	} else {
+		err = s.saver.SaveOrder(ctx, order)
+	}
+	countStored(order, err)
+	if err != nil {
+		return err
+	}
+	s.cache.Set(order.OrderUID, order)
+	return nil
+}
+
+// StoreBatch persists orders in a single transaction and caches the stored ones.
+// Per-order errors (stale versions, duplicates, ErrQuarantined) are returned in errs;
+// err fails the whole batch and leaves the cache untouched. Quarantined orders are
+// written separately, before the batch transaction.
+func (s *Service) StoreBatch(ctx context.Context, orders []*model.Order) (errs []error, err error) {
+	errs = make([]error, len(orders))
+	var (
+		save []*model.Order
+		idx  []int
+	)
+	for i, order := range orders {
+		violations := s.quarantineViolations(order)
+		if violations == nil {
+			save = append(save, order)
+			idx = append(idx, i)
+			continue
+		}
+		errs[i] = s.quarantine(ctx, order, violations)
+		if !errors.Is(errs[i], ErrQuarantined) && !errors.Is(errs[i], db.ErrDuplicate) {
+			return nil, errs[i]
+		}
+	}
+
+	if len(save) > 0 {
+		saved, err := s.saver.SaveOrders(ctx, save)
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range idx {
+			errs[i] = saved[j]
+		}
+	}
+	for i, order := range orders {
+		countStored(order, errs[i])
+		if errs[i] == nil {
+			s.cache.Set(order.OrderUID, order)
+		}
+	}
+	return errs, nil
+}
+
+// storedStatus tells a newly created order from an updated one after a successful save.
+func storedStatus(order *model.Order) Status {
+	if order.Created {
+		return StatusCreated
+	}
+	return StatusUpdated
+}
+
+// countStored counts the outcome of saving an order. Failures are not counted:
+// the order may still be retried.
+func countStored(order *model.Order, err error) {
+	switch {
+	case err == nil:
+		metrics.IngestOrders.Add(string(storedStatus(order)), 1)
+	case errors.Is(err, db.ErrDuplicate):
+		metrics.IngestOrders.Add(string(StatusDuplicate), 1)
+	case errors.Is(err, db.ErrStaleVersion):
+		metrics.IngestOrders.Add(string(StatusStale), 1)
+	case errors.Is(err, ErrQuarantined):
+		metrics.IngestOrders.Add(string(StatusQuarantined), 1)
+	}
+}
+
+// Ingest decodes and stores a single order, reporting the outcome instead of an error.
+func (s *Service) Ingest(ctx context.Context, data []byte) Result {
+	order, err := s.Decode(data)
+	if err != nil {
+		res := Result{OrderUID: peekOrderUID(data), Status: StatusInvalid, Error: err.Error()}
+		errors.As(err, &res.Errors)
+		errors.As(err, &res.Rules)
+		return res
+	}
+
+	res := Result{OrderUID: order.OrderUID}
+	switch err := s.Store(ctx, order); {
+	case err == nil:
+		res.Status = storedStatus(order)
+	case errors.Is(err, db.ErrDuplicate):
+		res.Status = StatusDuplicate
+	case errors.Is(err, db.ErrStaleVersion):
+		res.Status = StatusStale
+		res.Error = err.Error()
+	case errors.Is(err, ErrQuarantined):
+		res.Status = StatusQuarantined
+		errors.As(err, &res.Rules)
+	default:
+		log.Printf("Ошибка сохранения заказа %s: %v", order.OrderUID, err)
+		res.Status = StatusFailed
+		res.Error = "не удалось сохранить заказ"
+	}
+	return res
+}
+
+// peekOrderUID extracts order_uid from a payload that failed validation, for reporting only.
+func peekOrderUID(data []byte) string {
+	var probe struct {
+		OrderUID string `json:"order_uid"`
+	}
+	_ = json.Unmarshal(data, &probe)
+	return probe.OrderUID
+}
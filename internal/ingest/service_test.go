@@ -0,0 +1,267 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/cache"
+	"github.com/112Alex/demo-service.git/internal/db"
+	"github.com/112Alex/demo-service.git/internal/model"
+	"github.com/112Alex/demo-service.git/internal/model/modeltest"
+	"github.com/112Alex/demo-service.git/internal/rules"
+)
+
+type mockSaver struct {
+	err         error
+	exists      bool // saved orders replace existing ones
+	quarantined []*model.Order
+	refunds     []*model.Refund
+}
+
+func (m *mockSaver) SaveOrder(ctx context.Context, o *model.Order) error {
+	if m.err == nil {
+		o.Created = !m.exists
+	}
+	return m.err
+}
+
+func (m *mockSaver) SaveOrders(ctx context.Context, orders []*model.Order) ([]error, error) {
+	if m.err == nil {
+		for _, o := range orders {
+			o.Created = !m.exists
+		}
+	}
+	return make([]error, len(orders)), m.err
+}
+
+func (m *mockSaver) UpdateOrderStatus(ctx context.Context, upd *model.StatusUpdate) (*model.StatusChange, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &model.StatusChange{From: model.StatusCreated, To: upd.Status, RecordedAt: time.Now()}, nil
+}
+
+func (m *mockSaver) RecordRefund(ctx context.Context, r *model.Refund) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	m.refunds = append(m.refunds, r)
+	total := 0
+	for _, r := range m.refunds {
+		total += r.Amount
+	}
+	return total, nil
+}
+
+func (m *mockSaver) QuarantineOrder(ctx context.Context, o *model.Order, v rules.Violations) (int64, error) {
+	m.quarantined = append(m.quarantined, o)
+	return int64(len(m.quarantined)), m.err
+}
+
+// orderJSON returns the shared order fixture with uid "1", modified by fn.
+func orderJSON(t *testing.T, fn func(o *model.Order)) string {
+	t.Helper()
+	o := *modeltest.Order()
+	o.OrderUID = "1"
+	o.Payment.Transaction = "t1"
+	o.Payment.RequestID = "r1"
+	if fn != nil {
+		fn(&o)
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestService_Ingest(t *testing.T) {
+	valid := orderJSON(t, nil)
+	tests := []struct {
+		name    string
+		saveErr error
+		payload string
+		strict  bool
+		want    Status
+		cached  bool
+	}{
+		{"created", nil, valid, false, StatusCreated, true},
+		{"stale", db.ErrStaleVersion, orderJSON(t, func(o *model.Order) { o.Version = 1 }), false, StatusStale, false},
+		{"duplicate", db.ErrDuplicate, valid, false, StatusDuplicate, false},
+		{"failed", errors.New("connection reset"), valid, false, StatusFailed, false},
+		{"empty uid", nil, `{"track_number":"T"}`, false, StatusInvalid, false},
+		{"broken json", nil, `{"order_uid":`, false, StatusInvalid, false},
+		{"unknown field lenient", nil, valid[:len(valid)-1] + `,"extra":1}`, false, StatusCreated, true},
+		{"unknown field strict", nil, valid[:len(valid)-1] + `,"extra":1}`, true, StatusInvalid, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cache.NewCache(10, 0)
+			s := NewService(&mockSaver{err: tt.saveErr}, c, Options{Strict: tt.strict})
+
+			res := s.Ingest(context.Background(), []byte(tt.payload))
+			if res.Status != tt.want {
+				t.Errorf("Ожидался статус %s, получен %s (%s)", tt.want, res.Status, res.Error)
+			}
+			if _, ok := c.Get("1"); ok != tt.cached {
+				t.Errorf("Ожидалось cached=%v, получено %v", tt.cached, ok)
+			}
+			if tt.want == StatusInvalid && len(res.Errors) == 0 {
+				t.Error("Ожидались ошибки полей для некорректного заказа")
+			}
+		})
+	}
+}
+
+func TestService_IngestUpdated(t *testing.T) {
+	c := cache.NewCache(10, 0)
+	s := NewService(&mockSaver{exists: true}, c, Options{})
+
+	res := s.Ingest(context.Background(), []byte(orderJSON(t, nil)))
+	if res.Status != StatusUpdated {
+		t.Errorf("Ожидался статус %s, получен %s (%s)", StatusUpdated, res.Status, res.Error)
+	}
+	if _, ok := c.Get("1"); !ok {
+		t.Error("Обновленный заказ должен попасть в кэш")
+	}
+}
+
+func TestService_IgnoresRefunded(t *testing.T) {
+	c := cache.NewCache(10, 0)
+	s := NewService(&mockSaver{}, c, Options{})
+
+	res := s.Ingest(context.Background(), []byte(orderJSON(t, func(o *model.Order) { o.Payment.Refunded = 1817 })))
+	if res.Status != StatusCreated {
+		t.Fatalf("Ожидался статус created, получен %s (%s)", res.Status, res.Error)
+	}
+	if cached, _ := c.Get("1"); cached.Payment.Refunded != 0 {
+		t.Errorf("Сумма возвратов не должна приниматься с заказом, получено %d", cached.Payment.Refunded)
+	}
+}
+
+func TestService_IdempotencyKey(t *testing.T) {
+	content := NewService(&mockSaver{}, cache.NewCache(10, 0), Options{})
+	byRequest := NewService(&mockSaver{}, cache.NewCache(10, 0), Options{IdempotencyKey: KeyRequestID})
+
+	key := func(s *Service, payload string) string {
+		t.Helper()
+		order, err := s.Decode([]byte(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return order.IdempotencyKey
+	}
+
+	withAmount := func(amount int) func(o *model.Order) {
+		return func(o *model.Order) { o.Payment.Amount = amount }
+	}
+	a := key(content, orderJSON(t, nil))
+	var reordered map[string]interface{}
+	if err := json.Unmarshal([]byte(orderJSON(t, nil)), &reordered); err != nil {
+		t.Fatal(err)
+	}
+	pretty, _ := json.MarshalIndent(reordered, "", "  ") // другой порядок полей и форматирование
+	if b := key(content, string(pretty)); a != b {
+		t.Errorf("Ожидался одинаковый ключ для одинакового содержимого: %s != %s", a, b)
+	}
+	if b := key(content, orderJSON(t, withAmount(20))); a == b {
+		t.Error("Ожидались разные ключи для разного содержимого")
+	}
+
+	if got := key(byRequest, orderJSON(t, withAmount(20))); got != "request_id:r1" {
+		t.Errorf("Ожидался ключ request_id:r1, получен %s", got)
+	}
+	noRequestID := orderJSON(t, func(o *model.Order) { o.Payment.RequestID = "" })
+	if got := key(byRequest, noRequestID); got != key(content, noRequestID) {
+		t.Errorf("Без request_id ожидался ключ по содержимому, получен %s", got)
+	}
+}
+
+func TestService_Rules(t *testing.T) {
+	engine, err := rules.NewEngine(rules.Builtin(), map[string]rules.Severity{"payment_amount": rules.SeverityReject})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		modify func(o *model.Order)
+		want   Status
+		rules  int
+	}{
+		{"consistent", nil, StatusCreated, 0},
+		{"warning", func(o *model.Order) {
+			o.Items[0].TotalPrice = 453
+			o.Payment.GoodsTotal = 453
+			o.Payment.Amount = 1953
+		}, StatusCreated, 0},
+		{"rejected", func(o *model.Order) { o.Payment.Amount = 1 }, StatusInvalid, 1},
+		{"quarantined", func(o *model.Order) { o.Payment.GoodsTotal = 1; o.Payment.Amount = 1501 }, StatusQuarantined, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saver := &mockSaver{}
+			c := cache.NewCache(10, 0)
+			s := NewService(saver, c, Options{Rules: engine})
+
+			res := s.Ingest(context.Background(), []byte(orderJSON(t, tt.modify)))
+			if res.Status != tt.want {
+				t.Errorf("Ожидался статус %s, получен %s (%s)", tt.want, res.Status, res.Error)
+			}
+			if len(res.Rules) != tt.rules {
+				t.Errorf("Ожидалось %d нарушений в ответе, получено %v", tt.rules, res.Rules)
+			}
+			if quarantined := len(saver.quarantined) == 1; quarantined != (tt.want == StatusQuarantined) {
+				t.Errorf("Ожидалось quarantined=%v, получено %v", !quarantined, quarantined)
+			}
+			if _, ok := c.Get("1"); ok != (tt.want == StatusCreated) {
+				t.Errorf("Ожидалось cached=%v, получено %v", !ok, ok)
+			}
+		})
+	}
+}
+
+func TestService_StoreBatchQuarantine(t *testing.T) {
+	engine, err := rules.NewEngine(rules.Builtin(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saver := &mockSaver{}
+	c := cache.NewCache(10, 0)
+	s := NewService(saver, c, Options{Rules: engine})
+
+	decode := func(uid string, goodsTotal int) *model.Order {
+		t.Helper()
+		order, err := s.Decode([]byte(orderJSON(t, func(o *model.Order) {
+			o.OrderUID = uid
+			o.Payment.GoodsTotal = goodsTotal
+			o.Payment.Amount = goodsTotal + o.Payment.DeliveryCost
+		})))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return order
+	}
+	orders := []*model.Order{decode("ok", 317), decode("suspicious", 1)}
+
+	errs, err := s.StoreBatch(context.Background(), orders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs[0] != nil || !errors.Is(errs[1], ErrQuarantined) {
+		t.Fatalf("Ожидалось [nil, ErrQuarantined], получено %v", errs)
+	}
+	if len(saver.quarantined) != 1 || saver.quarantined[0].OrderUID != "suspicious" {
+		t.Errorf("Ожидался карантин только для suspicious, получено %d", len(saver.quarantined))
+	}
+	if _, ok := c.Get("suspicious"); ok {
+		t.Error("Заказ из карантина не должен попадать в кэш")
+	}
+	if _, ok := c.Get("ok"); !ok {
+		t.Error("Сохраненный заказ должен попасть в кэш")
+	}
+}
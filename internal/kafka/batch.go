@@ -0,0 +1,177 @@
+package kafka
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/ingest"
+	"github.com/112Alex/demo-service.git/internal/metrics"
+	"github.com/112Alex/demo-service.git/internal/model"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// consumeBatches is the batch-mode consumption loop used for backfills.
+// It accumulates up to batchSize messages or waits batchTimeout, persists the
+// batch in a single transaction and commits offsets once per batch.
+// Messages are fetched until fetch is done; the last collected batch is still
+// processed and committed with work.
+func (c *Consumer) consumeBatches(fetch, work context.Context) {
+	log.Printf("Запуск потребителя Kafka в пакетном режиме (пачка %d, ожидание %s)...", c.batchSize, c.batchTimeout)
+
+	fetched := make(chan kafka.Message)
+	go func() {
+		defer close(fetched)
+		c.life.guard("чтении сообщений", func() {
+			for {
+				if err := c.gate.wait(fetch); err != nil {
+					return
+				}
+				m, err := c.reader.FetchMessage(fetch)
+				if err != nil {
+					if fetch.Err() != nil {
+						return
+					}
+					log.Printf("Ошибка FetchMessage: %v", err)
+					continue
+				}
+				select {
+				case fetched <- m:
+				case <-fetch.Done():
+					return
+				}
+			}
+		})
+	}()
+
+	for {
+		batch, open := c.collectBatch(fetched)
+		if len(batch) > 0 {
+			c.processBatch(work, batch)
+		}
+		if !open {
+			return
+		}
+	}
+}
+
+// collectBatch waits for the first message, then collects more until the
+// batch is full or batchTimeout elapses. open is false once fetching stopped.
+func (c *Consumer) collectBatch(fetched <-chan kafka.Message) (batch []kafka.Message, open bool) {
+	m, ok := <-fetched
+	if !ok {
+		return nil, false
+	}
+	batch = append(batch, m)
+
+	timer := time.NewTimer(c.batchTimeout)
+	defer timer.Stop()
+	for len(batch) < c.batchSize {
+		select {
+		case m, ok := <-fetched:
+			if !ok {
+				return batch, false
+			}
+			batch = append(batch, m)
+		case <-timer.C:
+			return batch, true
+		}
+	}
+	return batch, true
+}
+
+// processBatch persists a batch and commits the offsets of handled messages.
+// Undecodable messages go to the DLQ individually; events other than orders are
+// applied one by one after the batch. If the batch transaction
+// fails, messages are handled one by one to isolate the poison message.
+func (c *Consumer) processBatch(ctx context.Context, batch []kafka.Message) {
+	for _, m := range batch {
+		c.offsets.track(m)
+	}
+
+	handled := make([]kafka.Message, 0, len(batch))
+	var (
+		orders      []*model.Order
+		orderEvents []*ingest.Event
+		orderMsg    []kafka.Message
+		events      []*ingest.Event
+		eventMsg    []kafka.Message
+	)
+	for _, m := range batch {
+		ev, err := c.decodeEvent(m)
+		if err != nil {
+			if err := c.rejectInvalid(ctx, m, ev, err); err != nil {
+				log.Printf("Не удалось отправить сообщение offset %d в DLQ: %v", m.Offset, err)
+				continue
+			}
+			handled = append(handled, m)
+			continue
+		}
+		if ev.Order == nil {
+			events = append(events, ev)
+			eventMsg = append(eventMsg, m)
+			continue
+		}
+		orders = append(orders, ev.Order)
+		orderEvents = append(orderEvents, ev)
+		orderMsg = append(orderMsg, m)
+	}
+
+	if len(orders) > 0 {
+		errs, err := c.ingest.StoreBatch(ctx, orders)
+		if err != nil {
+			log.Printf("Не удалось сохранить пачку из %d заказов, обработка по одному: %v", len(orders), err)
+			for i, m := range orderMsg {
+				if err := c.handleEvent(ctx, m, orderEvents[i]); err != nil {
+					log.Printf("Не удалось обработать сообщение partition %d offset %d: %v", m.Partition, m.Offset, err)
+					continue
+				}
+				handled = append(handled, m)
+			}
+		} else {
+			for i, m := range orderMsg {
+				if errs[i] != nil {
+					log.Printf("Заказ %s пропущен: %v", orders[i].OrderUID, errs[i])
+					metrics.CountEvent(orderEvents[i].Type, metrics.EventSkipped)
+				} else {
+					metrics.CountEvent(orderEvents[i].Type, metrics.EventProcessed)
+				}
+				handled = append(handled, m)
+			}
+		}
+	}
+
+	// Other events follow the orders of the batch, so an order created
+	// in the same batch already exists. Their relative order is kept.
+	for i, m := range eventMsg {
+		if err := c.handleEvent(ctx, m, events[i]); err != nil {
+			log.Printf("Не удалось обработать сообщение partition %d offset %d: %v", m.Partition, m.Offset, err)
+			continue
+		}
+		handled = append(handled, m)
+	}
+
+	c.commitHandled(ctx, handled)
+}
+
+// commitHandled commits the furthest contiguous offset of each partition in one call.
+func (c *Consumer) commitHandled(ctx context.Context, handled []kafka.Message) {
+	commits := make(map[partitionKey]kafka.Message)
+	for _, m := range handled {
+		if commit, ok := c.offsets.markDone(m); ok {
+			commits[partitionKey{commit.Topic, commit.Partition}] = commit
+		}
+	}
+	if len(commits) == 0 {
+		return
+	}
+
+	msgs := make([]kafka.Message, 0, len(commits))
+	for _, m := range commits {
+		msgs = append(msgs, m)
+	}
+	if err := c.reader.CommitMessages(ctx, msgs...); err != nil {
+		log.Printf("Ошибка CommitMessages: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/112Alex/demo-service.git/internal/cache"
+	"github.com/112Alex/demo-service.git/internal/ingest"
+	"github.com/112Alex/demo-service.git/internal/model"
+	"github.com/112Alex/demo-service.git/internal/model/modeltest"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type fakeReader struct {
+	committed []kafka.Message
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.committed = append(r.committed, msgs...)
+	return nil
+}
+
+func (r *fakeReader) Close() error { return nil }
+
+type fakeWriter struct {
+	written []kafka.Message
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.written = append(w.written, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error { return nil }
+
+// validOrder returns the shared order fixture with the given uid and transaction.
+func validOrder(uid string) model.Order {
+	o := modeltest.Order()
+	o.OrderUID = uid
+	o.Payment.Transaction = uid
+	return *o
+}
+
+func orderMessage(t *testing.T, offset int64, uid string) kafka.Message {
+	t.Helper()
+	value, err := json.Marshal(validOrder(uid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kafka.Message{Topic: "orders", Offset: offset, Key: []byte(uid), Value: value}
+}
+
+func TestConsumer_ProcessBatch(t *testing.T) {
+	reader, writer := &fakeReader{}, &fakeWriter{}
+	orderCache := cache.NewCache(10, 0)
+	c := &Consumer{
+		reader:  reader,
+		writer:  writer,
+		ingest:  ingest.NewService(&mockDB{}, orderCache, ingest.Options{}),
+		offsets: newOffsetTracker(),
+	}
+
+	c.processBatch(context.Background(), []kafka.Message{
+		orderMessage(t, 0, "1"),
+		{Topic: "orders", Offset: 1, Value: []byte("not json")},
+		orderMessage(t, 2, "2"),
+	})
+
+	if len(writer.written) != 1 {
+		t.Fatalf("expected 1 message in DLQ, got %d", len(writer.written))
+	}
+	if md := ParseDLQMetadata(writer.written[0].Headers); md.ErrorClass != ErrorClassInvalid || len(md.ValidationErrors) == 0 {
+		t.Errorf("expected validation errors in DLQ metadata, got %+v", md)
+	}
+	if len(reader.committed) != 1 || reader.committed[0].Offset != 2 {
+		t.Errorf("expected a single commit at offset 2, got %+v", reader.committed)
+	}
+	for _, uid := range []string{"1", "2"} {
+		if _, ok := orderCache.Get(uid); !ok {
+			t.Errorf("expected order %s to be cached", uid)
+		}
+	}
+}
+
+func TestConsumer_ProcessBatchFallsBackToSingleMessages(t *testing.T) {
+	reader := &fakeReader{}
+	// The batch transaction fails once; the per-message fallback then succeeds.
+	c := &Consumer{
+		reader:  reader,
+		writer:  &fakeWriter{},
+		ingest:  ingest.NewService(&mockDB{saveErrCount: 1}, cache.NewCache(10, 0), ingest.Options{}),
+		offsets: newOffsetTracker(),
+	}
+
+	c.processBatch(context.Background(), []kafka.Message{
+		orderMessage(t, 0, "1"),
+		orderMessage(t, 1, "2"),
+	})
+
+	if len(reader.committed) != 1 || reader.committed[0].Offset != 1 {
+		t.Errorf("expected a single commit at offset 1, got %+v", reader.committed)
+	}
+}
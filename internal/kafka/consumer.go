@@ -2,121 +2,384 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"log"
+	"math"
+	"strconv"
+	"sync"
 	"time"
 
-	"github.com/112Alex/demo-service.git/internal/cache"
+	"github.com/112Alex/demo-service.git/internal/codec"
 	"github.com/112Alex/demo-service.git/internal/config"
-	"github.com/112Alex/demo-service.git/internal/model"
+	"github.com/112Alex/demo-service.git/internal/db"
+	"github.com/112Alex/demo-service.git/internal/ingest"
+	"github.com/112Alex/demo-service.git/internal/metrics"
+	"github.com/112Alex/demo-service.git/internal/retry"
 
 	"github.com/segmentio/kafka-go"
 )
 
-type OrderSaver interface {
-	SaveOrder(ctx context.Context, order *model.Order) error
+// messageReader is the subset of *kafka.Reader used by the consumer.
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
 }
 
+// messageWriter is the subset of *kafka.Writer used by the consumer.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// workerQueueSize bounds the number of messages buffered per worker.
+const workerQueueSize = 16
+
+// HeaderEventType is the event type of a bare message on the orders topic, e.g.
+// ingest.EventOrderStatusUpdated. Without it a message is an event envelope
+// (model.EventEnvelope) or a bare order, see ingest.Service.DecodeEvent.
+const HeaderEventType = "x-event-type"
+
+// HeaderContentType is the content type of a message payload, see codec.Decoders.
+// Messages without it are JSON.
+const HeaderContentType = "content-type"
+
 // Consumer represents a Kafka consumer with retry and DLQ support.
-// It consumes messages, attempts to persist them, stores them in cache and commits offsets.
+// It consumes messages, passes them to the ingestion service and commits offsets.
+//
+// Messages are processed by a pool of workers. Messages with the same key
+// (order_uid) always go to the same worker, so per-order ordering is preserved,
+// and offsets are committed only up to the last contiguously processed message.
 type Consumer struct {
-	reader *kafka.Reader
-	writer *kafka.Writer
-	db     OrderSaver
-	cache  *cache.Cache
+	reader  messageReader
+	writer  messageWriter
+	ingest  *ingest.Service
+	// converts Protobuf and Avro payloads to JSON; nil accepts only JSON
+	decoders *codec.Decoders
+	offsets *offsetTracker
+	workers int
+
+	// batch mode (batchSize > 1), see consumeBatches
+	batchSize    int
+	batchTimeout time.Duration
+
+	retry retry.Policy
+
+	// DLQ and retry topic writes are retried until they succeed,
+	// pausing consumption meanwhile, see publish.go
+	publishRetry retry.Policy
+	gate         publishGate
 
-	maxRetries     int
-	retryBackoff   time.Duration
+	// delayed retry topology, see retry_topics.go
+	topic        string
+	deadTopic    string
+	tiers        []config.RetryTier
+	retryReaders []messageReader // one per tier
+
+	// drain on shutdown, see shutdown.go
+	life lifecycle
 }
 
 // NewConsumer creates a consumer and DLQ producer based on config.
-func NewConsumer(cfg *config.Config, dbSaver OrderSaver, cache *cache.Cache) *Consumer {
+func NewConsumer(cfg *config.Config, svc *ingest.Service) *Consumer {
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers: cfg.KafkaBrokers,
 		Topic:   cfg.KafkaTopic,
-		GroupID: "order-consumer-group",
+		GroupID: consumerGroupID,
 		MinBytes: 10e3,
 		MaxBytes: 10e6,
 	})
 
+	// The writer serves the DLQ and retry topics, so the topic is set per message.
 	writer := &kafka.Writer{
 		Addr:     kafka.TCP(cfg.KafkaBrokers...),
-		Topic:    cfg.KafkaDeadTopic,
-		Balancer: &kafka.LeastBytes{},
+		Balancer: &kafka.Hash{},
+	}
+
+	var schemas *codec.SchemaRegistry
+	if cfg.SchemaRegistryDir != "" {
+		schemas = codec.NewSchemaRegistry(cfg.SchemaRegistryDir)
+	}
+
+	retryReaders := make([]messageReader, len(cfg.KafkaRetryTiers))
+	for i, tier := range cfg.KafkaRetryTiers {
+		retryReaders[i] = kafka.NewReader(kafka.ReaderConfig{
+			Brokers:  cfg.KafkaBrokers,
+			Topic:    tier.Topic,
+			GroupID:  retryGroupID(tier.Topic),
+			MinBytes: 10e3,
+			MaxBytes: 10e6,
+		})
 	}
 
 	return &Consumer{
 		reader: reader,
 		writer: writer,
-		db:     dbSaver,
-		cache:  cache,
-		maxRetries:   cfg.KafkaMaxRetries,
-		retryBackoff: cfg.KafkaRetryBackoff,
+		ingest: svc,
+		decoders: codec.NewDecoders(schemas),
+		offsets: newOffsetTracker(),
+		workers: cfg.KafkaWorkers,
+		batchSize:    cfg.KafkaBatchSize,
+		batchTimeout: cfg.KafkaBatchTimeout,
+		retry:  newRetryPolicy(cfg),
+		publishRetry: retry.Policy{
+			MaxAttempts:  math.MaxInt,
+			InitialDelay: cfg.KafkaRetryBackoff,
+			MaxDelay:     cfg.KafkaRetryMaxBackoff,
+			Multiplier:   2,
+			Jitter:       cfg.KafkaRetryJitter,
+		},
+		topic:        cfg.KafkaTopic,
+		deadTopic:    cfg.KafkaDeadTopic,
+		tiers:        cfg.KafkaRetryTiers,
+		retryReaders: retryReaders,
+	}
+}
+
+// newRetryPolicy builds the in-process DB retry policy from config.
+func newRetryPolicy(cfg *config.Config) retry.Policy {
+	return retry.Policy{
+		MaxAttempts:  cfg.KafkaMaxRetries + 1,
+		InitialDelay: cfg.KafkaRetryBackoff,
+		MaxDelay:     cfg.KafkaRetryMaxBackoff,
+		Multiplier:   2,
+		Jitter:       cfg.KafkaRetryJitter,
 	}
 }
 
-// StartConsumption launches message consumption loop until context is cancelled.
-func (c *Consumer) StartConsumption(ctx context.Context) {
-	log.Println("Запуск потребителя Kafka...")
+// StartConsumption launches message consumption loop until Shutdown is called or
+// context is cancelled. Retry tier topics, if configured, are consumed concurrently
+// with the main topic. Readers and the writer are closed on return.
+// A panic in any consumption goroutine stops the consumer and is returned as an error;
+// otherwise the result is nil.
+func (c *Consumer) StartConsumption(ctx context.Context) (err error) {
+	l := c.lifecycle()
+	fetch, work, cancel := l.run(ctx)
+	var tiers sync.WaitGroup
+	defer func() {
+		cancel()
+		tiers.Wait()
+		// Closing the readers leaves the consumer group, so partitions are
+		// rebalanced right away instead of after the session timeout.
+		errs := []error{c.reader.Close()}
+		for _, r := range c.retryReaders {
+			errs = append(errs, r.Close())
+		}
+		errs = append(errs, c.writer.Close())
+		l.err = errors.Join(errs...)
+		l.mu.Lock()
+		err = l.failure
+		l.mu.Unlock()
+		close(l.done)
+		log.Println("Потребитель Kafka остановлен")
+	}()
+
+	for i := range c.tiers {
+		tiers.Add(1)
+		go func(i int) {
+			defer tiers.Done()
+			l.guard("потребителе "+c.tiers[i].Topic, func() { c.consumeRetryTier(fetch, work, i) })
+		}(i)
+	}
+
+	l.guard("потребителе Kafka", func() {
+		if c.batchSize > 1 {
+			c.consumeBatches(fetch, work)
+		} else {
+			c.consumeConcurrently(fetch, work)
+		}
+	})
+	tiers.Wait()
+	return nil
+}
+
+// consumeConcurrently is the default consumption loop backed by the worker pool.
+// Messages are fetched until fetch is done; started messages are processed and
+// committed with work, queued ones are left for redelivery.
+func (c *Consumer) consumeConcurrently(fetch, work context.Context) {
+	log.Printf("Запуск потребителя Kafka (обработчиков: %d)...", c.workers)
+
+	processed := make(chan kafka.Message, c.workers*workerQueueSize)
+	committerDone := make(chan struct{})
+	go func() {
+		defer close(committerDone)
+		c.life.guard("фиксации смещений", func() { c.commitLoop(work, processed) })
+	}()
+
+	var wg sync.WaitGroup
+	queues := make([]chan kafka.Message, c.workers)
+	// Deferred so that the workers and the committer also stop if the fetch loop panics.
+	defer func() {
+		for _, q := range queues {
+			close(q)
+		}
+		wg.Wait()
+		close(processed)
+		<-committerDone
+	}()
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, workerQueueSize)
+		wg.Add(1)
+		go func(queue <-chan kafka.Message) {
+			defer wg.Done()
+			c.life.guard("обработчике сообщений", func() {
+				for m := range queue {
+					if fetch.Err() != nil {
+						// draining: queued messages stay uncommitted and are redelivered
+						continue
+					}
+					if err := c.handleMessage(work, m); err != nil {
+						log.Printf("Не удалось обработать сообщение partition %d offset %d: %v", m.Partition, m.Offset, err)
+						// not marked as processed: the partition is not committed past this offset
+						continue
+					}
+					select {
+					case processed <- m:
+					case <-work.Done(): // the committer failed
+					}
+				}
+			})
+		}(queues[i])
+	}
 
 	for {
-		m, err := c.reader.FetchMessage(ctx)
+		if err := c.gate.wait(fetch); err != nil {
+			break
+		}
+		m, err := c.reader.FetchMessage(fetch)
 		if err != nil {
-			if ctx.Err() != nil {
+			if fetch.Err() != nil {
 				break
 			}
 			log.Printf("Ошибка FetchMessage: %v", err)
 			continue
 		}
 
-		if err := c.handleMessage(ctx, m); err != nil {
-			log.Printf("Не удалось обработать сообщение offset %d: %v", m.Offset, err)
-			// don't commit offset to allow reprocessing; optionally send to DLQ already here
-			continue
+		c.offsets.track(m)
+		select {
+		case queues[c.workerFor(m)] <- m:
+		case <-fetch.Done(): // the worker failed or shutdown started
 		}
+	}
+}
 
-		if err := c.reader.CommitMessages(ctx, m); err != nil {
+// commitLoop commits offsets of processed messages. It is the only goroutine
+// calling CommitMessages, so commit points of a partition never move backwards.
+func (c *Consumer) commitLoop(ctx context.Context, processed <-chan kafka.Message) {
+	for m := range processed {
+		commit, ok := c.offsets.markDone(m)
+		if !ok {
+			continue
+		}
+		if err := c.reader.CommitMessages(ctx, commit); err != nil {
 			log.Printf("Ошибка CommitMessages: %v", err)
 		}
 	}
+}
 
-	_ = c.reader.Close()
-	_ = c.writer.Close()
+// workerFor picks the worker for a message by its key, falling back to the
+// partition for keyless messages so their partition order is kept.
+func (c *Consumer) workerFor(m kafka.Message) int {
+	h := fnv.New32a()
+	if len(m.Key) > 0 {
+		h.Write(m.Key)
+	} else {
+		h.Write([]byte(m.Topic + "/" + strconv.Itoa(m.Partition)))
+	}
+	return int(h.Sum32() % uint32(c.workers))
 }
 
-// handleMessage processes message with retry and DLQ.
+// skipped reports whether an event was deliberately not applied: it is stale,
+// already processed or quarantined. The message is committed without retries.
+func skipped(err error) bool {
+	return errors.Is(err, db.ErrStaleVersion) || errors.Is(err, db.ErrDuplicate) || errors.Is(err, ingest.ErrQuarantined)
+}
+
+// handleMessage decodes and processes a message with retry and DLQ.
 func (c *Consumer) handleMessage(ctx context.Context, m kafka.Message) error {
-	var order model.Order
-	if err := json.Unmarshal(m.Value, &order); err != nil {
-		log.Printf("Ошибка JSON, отправляем в DLQ: %v", err)
-		return c.produceToDLQ(ctx, m)
-	}
-	if order.OrderUID == "" {
-		log.Println("Пустой order_uid, отправляем в DLQ")
-		return c.produceToDLQ(ctx, m)
+	ev, err := c.decodeEvent(m)
+	if err != nil {
+		return c.rejectInvalid(ctx, m, ev, err)
 	}
+	return c.handleEvent(ctx, m, ev)
+}
 
-	// retry loop for DB save
-	var err error
-	for attempt := 0; attempt <= c.maxRetries; attempt++ {
-		err = c.db.SaveOrder(ctx, &order)
-		if err == nil {
-			break
+// decodeEvent converts the payload of m to JSON by its content type and decodes the event.
+// Like ingest.Service.DecodeEvent, it returns an event carrying the type on error.
+func (c *Consumer) decodeEvent(m kafka.Message) (*ingest.Event, error) {
+	eventType := headerValue(m.Headers, HeaderEventType)
+	data, err := c.decoders.Decode(headerValue(m.Headers, HeaderContentType), m.Value)
+	if err != nil {
+		if eventType == "" {
+			eventType = ingest.EventOrder
 		}
-		log.Printf("Ошибка сохранения заказа %s, попытка %d/%d: %v", order.OrderUID, attempt+1, c.maxRetries+1, err)
-		time.Sleep(c.retryBackoff)
+		return &ingest.Event{Type: eventType}, fmt.Errorf("%w: %w", ingest.ErrInvalidEvent, err)
 	}
-
-	if err != nil {
-		log.Printf("Не удалось сохранить заказ %s после %d попыток, отправка в DLQ", order.OrderUID, c.maxRetries+1)
-		return c.produceToDLQ(ctx, m)
+	ev, err := c.ingest.DecodeEvent(eventType, data, messageSource(m))
+	if err == nil && ev.Order != nil {
+		// a delayed retry must not overwrite changes applied while it waited
+		ev.Order.UnchangedSince = retryParkedAt(m)
 	}
+	return ev, err
+}
 
-	c.cache.Set(order.OrderUID, &order)
-	return nil
+// messageSource identifies m by the position where it was first consumed. Retry
+// tiers and DLQ replays keep that position in headers, so every delivery of the
+// message shares its idempotency key.
+func messageSource(m kafka.Message) string {
+	topic, partition, offset := originalPosition(m)
+	return fmt.Sprintf("%s/%d/%d", topic, partition, offset)
+}
+
+// rejectInvalid sends an undecodable message to the DLQ.
+func (c *Consumer) rejectInvalid(ctx context.Context, m kafka.Message, ev *ingest.Event, err error) error {
+	log.Printf("%v, отправляем в DLQ", err)
+	eventType := ev.Type
+	if !ingest.KnownEvent(eventType) {
+		eventType = metrics.EventTypeUnknown
+	}
+	metrics.CountEvent(eventType, metrics.EventInvalid)
+	return c.produceToDLQ(ctx, m, failure{err: err, class: ErrorClassInvalid, attempts: 1})
 }
 
-// produceToDLQ sends the original message to dead-letter topic.
-func (c *Consumer) produceToDLQ(ctx context.Context, m kafka.Message) error {
-	return c.writer.WriteMessages(ctx, kafka.Message{Key: m.Key, Value: m.Value, Time: time.Now()})
+// handleEvent applies a decoded event with retry and DLQ.
+func (c *Consumer) handleEvent(ctx context.Context, m kafka.Message, ev *ingest.Event) error {
+	// retry loop for DB save: only transient errors are retried, with exponential backoff
+	attempts := 0
+	err := c.retry.Do(ctx, func(attempt int) error {
+		attempts = attempt
+		err := ev.Apply(ctx)
+		if err != nil && !skipped(err) {
+			log.Printf("Ошибка обработки события %s заказа %s (%s), попытка %d/%d: %v", ev.Type, ev.OrderUID, db.Classify(err), attempt, c.retry.MaxAttempts, err)
+		}
+		return err
+	}, func(err error) bool { return !skipped(err) && db.IsRetryable(err) })
+
+	switch {
+	case err == nil:
+		metrics.CountEvent(ev.Type, metrics.EventProcessed)
+		return nil
+	case skipped(err):
+		log.Printf("Событие %s заказа %s пропущено: %v", ev.Type, ev.OrderUID, err)
+		metrics.CountEvent(ev.Type, metrics.EventSkipped)
+		return nil
+	case ctx.Err() != nil:
+		// shutting down: leave the message uncommitted for redelivery
+		return ctx.Err()
+	}
+
+	f := failure{err: err, class: string(db.Classify(err)), attempts: attempts}
+	if db.IsRetryable(err) {
+		if tier, ok := c.nextRetryTier(m); ok {
+			log.Printf("Не удалось обработать событие %s заказа %s, отложенный повтор через %s (%s): %v", ev.Type, ev.OrderUID, c.tiers[tier].Delay, c.tiers[tier].Topic, err)
+			metrics.CountEvent(ev.Type, metrics.EventRetried)
+			return c.produceToRetry(ctx, m, tier, f)
+		}
+	}
+
+	log.Printf("Не удалось обработать событие %s заказа %s (%s), отправка в DLQ: %v", ev.Type, ev.OrderUID, f.class, err)
+	metrics.CountEvent(ev.Type, metrics.EventDeadLettered)
+	return c.produceToDLQ(ctx, m, f)
 }
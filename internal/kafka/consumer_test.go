@@ -4,18 +4,26 @@ import (
     "context"
     "encoding/json"
     "errors"
+    "expvar"
     "testing"
     "time"
 
     "github.com/112Alex/demo-service.git/internal/cache"
     "github.com/112Alex/demo-service.git/internal/config"
+    "github.com/112Alex/demo-service.git/internal/db"
+    "github.com/112Alex/demo-service.git/internal/ingest"
+    "github.com/112Alex/demo-service.git/internal/metrics"
     "github.com/112Alex/demo-service.git/internal/model"
+    "github.com/112Alex/demo-service.git/internal/rules"
 
+    "github.com/lib/pq"
     "github.com/segmentio/kafka-go"
 )
 
 type mockDB struct {
-    saveErrCount int
+    saveErrCount  int
+    statusUpdates []*model.StatusUpdate
+    refunds       []*model.Refund
 }
 
 func (m *mockDB) SaveOrder(ctx context.Context, o *model.Order) error {
@@ -26,16 +34,251 @@ func (m *mockDB) SaveOrder(ctx context.Context, o *model.Order) error {
     return nil
 }
 
+func (m *mockDB) SaveOrders(ctx context.Context, orders []*model.Order) ([]error, error) {
+    errs := make([]error, len(orders))
+    for _, o := range orders {
+        if err := m.SaveOrder(ctx, o); err != nil {
+            return nil, err
+        }
+    }
+    return errs, nil
+}
+
+func (m *mockDB) QuarantineOrder(ctx context.Context, o *model.Order, v rules.Violations) (int64, error) {
+    return 1, nil
+}
+
+func (m *mockDB) UpdateOrderStatus(ctx context.Context, upd *model.StatusUpdate) (*model.StatusChange, error) {
+    m.statusUpdates = append(m.statusUpdates, upd)
+    return &model.StatusChange{From: model.StatusCreated, To: upd.Status}, nil
+}
+
+func (m *mockDB) RecordRefund(ctx context.Context, r *model.Refund) (int, error) {
+    m.refunds = append(m.refunds, r)
+    return r.Amount, nil
+}
+
 // remaining methods to satisfy interface (compile only)
 func (m *mockDB) Close() error                        { return nil }
 
 func TestConsumer_RetryLogic(t *testing.T) {
     cfg := &config.Config{KafkaMaxRetries: 2, KafkaRetryBackoff: 1 * time.Millisecond, CacheCapacity: 10, CacheTTL: 0}
-    c := &Consumer{db: &mockDB{saveErrCount: 2}, cache: cache.NewCache(10, 0), maxRetries: cfg.KafkaMaxRetries, retryBackoff: cfg.KafkaRetryBackoff}
-    order := model.Order{OrderUID: "1"}
+    c := &Consumer{ingest: ingest.NewService(&mockDB{saveErrCount: 2}, cache.NewCache(10, 0), ingest.Options{}), retry: newRetryPolicy(cfg)}
+    order := validOrder("1")
     msgValue, _ := json.Marshal(order)
     err := c.handleMessage(context.Background(), kafka.Message{Value: msgValue})
     if err != nil {
         t.Errorf("expected success after retries, got %v", err)
     }
-}
\ No newline at end of file
+}
+
+type permanentErrDB struct {
+    mockDB
+    calls int
+}
+
+func (m *permanentErrDB) SaveOrder(ctx context.Context, o *model.Order) error {
+    m.calls++
+    return &pq.Error{Code: "23505"} // unique_violation
+}
+
+func TestConsumer_PermanentErrorGoesToDLQ(t *testing.T) {
+    cfg := &config.Config{KafkaMaxRetries: 3, KafkaRetryBackoff: time.Millisecond}
+    saver := &permanentErrDB{}
+    writer := &fakeWriter{}
+    c := &Consumer{writer: writer, ingest: ingest.NewService(saver, cache.NewCache(10, 0), ingest.Options{}), retry: newRetryPolicy(cfg)}
+
+    msgValue, _ := json.Marshal(validOrder("1"))
+    if err := c.handleMessage(context.Background(), kafka.Message{Value: msgValue}); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if saver.calls != 1 {
+        t.Errorf("expected a single save attempt for a permanent error, got %d", saver.calls)
+    }
+    if len(writer.written) != 1 {
+        t.Errorf("expected message in DLQ, got %d", len(writer.written))
+    }
+}
+func TestConsumer_StatusUpdate(t *testing.T) {
+    saver := &mockDB{}
+    writer := &fakeWriter{}
+    c := &Consumer{writer: writer, ingest: ingest.NewService(saver, cache.NewCache(10, 0), ingest.Options{}), retry: newRetryPolicy(&config.Config{})}
+    headers := []kafka.Header{{Key: HeaderEventType, Value: []byte(ingest.EventOrderStatusUpdated)}}
+
+    m := kafka.Message{Headers: headers, Value: []byte(`{"order_uid":"1","status":"shipped"}`)}
+    if err := c.handleMessage(context.Background(), m); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(saver.statusUpdates) != 1 || saver.statusUpdates[0].Status != model.StatusShipped {
+        t.Fatalf("expected status update to be applied, got %v", saver.statusUpdates)
+    }
+
+    m = kafka.Message{Headers: headers, Value: []byte(`{"order_uid":"1","status":"lost"}`)}
+    if err := c.handleMessage(context.Background(), m); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(writer.written) != 1 {
+        t.Fatalf("expected invalid status update in DLQ, got %d messages", len(writer.written))
+    }
+    if md := ParseDLQMetadata(writer.written[0].Headers); md.ErrorClass != ErrorClassInvalid {
+        t.Errorf("expected error class %s, got %s", ErrorClassInvalid, md.ErrorClass)
+    }
+}
+
+func TestConsumer_EventEnvelope(t *testing.T) {
+    saver := &mockDB{}
+    writer := &fakeWriter{}
+    c := &Consumer{writer: writer, ingest: ingest.NewService(saver, cache.NewCache(10, 0), ingest.Options{}), retry: newRetryPolicy(&config.Config{})}
+
+    processed := func() int64 {
+        byOutcome, _ := metrics.Events.Get(ingest.EventPaymentRefunded).(*expvar.Map)
+        if byOutcome == nil {
+            return 0
+        }
+        n, _ := byOutcome.Get(metrics.EventProcessed).(*expvar.Int)
+        if n == nil {
+            return 0
+        }
+        return n.Value()
+    }
+    before := processed()
+
+    msgs := []string{
+        `{"type":"PaymentRefunded","version":1,"payload":{"order_uid":"1","amount":100}}`,
+        `{"type":"OrderCancelled","version":1,"payload":{"order_uid":"1","reason":"customer"}}`,
+        `{"type":"OrderLost","version":1,"payload":{"order_uid":"1"}}`,
+    }
+    for _, v := range msgs {
+        if err := c.handleMessage(context.Background(), kafka.Message{Value: []byte(v)}); err != nil {
+            t.Fatalf("unexpected error: %v", err)
+        }
+    }
+
+    if len(saver.refunds) != 1 || saver.refunds[0].Amount != 100 {
+        t.Errorf("expected refund to be recorded, got %v", saver.refunds)
+    }
+    if len(saver.statusUpdates) != 1 || saver.statusUpdates[0].Status != model.StatusCancelled {
+        t.Errorf("expected order to be cancelled, got %v", saver.statusUpdates)
+    }
+    if len(writer.written) != 1 {
+        t.Errorf("expected unknown event in DLQ, got %d messages", len(writer.written))
+    }
+    if got := processed() - before; got != 1 {
+        t.Errorf("expected processed refund to be counted once, got %d", got)
+    }
+    if metrics.Events.Get("OrderLost") != nil {
+        t.Error("expected unknown event type to be counted as unknown")
+    }
+    if metrics.Events.Get(metrics.EventTypeUnknown) == nil {
+        t.Error("expected unknown event to be counted")
+    }
+}
+
+func TestConsumer_UnsupportedContentType(t *testing.T) {
+    writer := &fakeWriter{}
+    c := &Consumer{writer: writer, ingest: ingest.NewService(&mockDB{}, cache.NewCache(10, 0), ingest.Options{}), retry: newRetryPolicy(&config.Config{})}
+
+    msgValue, _ := json.Marshal(validOrder("1"))
+    m := kafka.Message{Value: msgValue, Headers: []kafka.Header{{Key: HeaderContentType, Value: []byte("application/json; charset=utf-8")}}}
+    if err := c.handleMessage(context.Background(), m); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(writer.written) != 0 {
+        t.Fatalf("expected JSON with content type to be stored, got %d DLQ messages", len(writer.written))
+    }
+
+    m = kafka.Message{Value: []byte{0, 0, 0, 0, 1, 2}, Headers: []kafka.Header{{Key: HeaderContentType, Value: []byte("application/x-protobuf")}}}
+    if err := c.handleMessage(context.Background(), m); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(writer.written) != 1 {
+        t.Fatalf("expected protobuf message without schema registry in DLQ, got %d messages", len(writer.written))
+    }
+    if md := ParseDLQMetadata(writer.written[0].Headers); md.ErrorClass != ErrorClassInvalid {
+        t.Errorf("expected error class %s, got %s", ErrorClassInvalid, md.ErrorClass)
+    }
+}
+
+// ledgerDB rejects orders whose idempotency key was already saved, like db.DBClient.
+type ledgerDB struct {
+    mockDB
+    keys  map[string]bool
+    saved []*model.Order
+    // lostAcks saves that commit but report an error, as if the commit
+    // acknowledgement was lost
+    lostAcks int
+}
+
+func (m *ledgerDB) SaveOrder(ctx context.Context, o *model.Order) error {
+    if m.keys[o.IdempotencyKey] {
+        return db.ErrDuplicate
+    }
+    m.keys[o.IdempotencyKey] = true
+    m.saved = append(m.saved, o)
+    if m.lostAcks > 0 {
+        m.lostAcks--
+        return errors.New("connection reset")
+    }
+    return nil
+}
+
+func (m *ledgerDB) RecordRefund(ctx context.Context, r *model.Refund) (int, error) {
+    if m.keys[r.IdempotencyKey] {
+        return 0, db.ErrDuplicate
+    }
+    m.keys[r.IdempotencyKey] = true
+    m.refunds = append(m.refunds, r)
+    if m.lostAcks > 0 {
+        m.lostAcks--
+        return 0, errors.New("connection reset")
+    }
+    return r.Amount, nil
+}
+
+func TestConsumer_ContentKeyDeduplicatesResend(t *testing.T) {
+    saver := &ledgerDB{keys: make(map[string]bool)}
+    c := &Consumer{writer: &fakeWriter{}, ingest: ingest.NewService(saver, cache.NewCache(10, 0), ingest.Options{}), retry: newRetryPolicy(&config.Config{})}
+
+    value, _ := json.Marshal(validOrder("1"))
+    // the producer sends the same order twice
+    for _, m := range []kafka.Message{{Topic: "orders", Offset: 0, Value: value}, {Topic: "orders", Offset: 1, Value: value}} {
+        if err := c.handleMessage(context.Background(), m); err != nil {
+            t.Fatalf("unexpected error: %v", err)
+        }
+    }
+    if len(saver.saved) != 1 {
+        t.Fatalf("expected 1 save, got %d", len(saver.saved))
+    }
+}
+
+func TestConsumer_OrderChangedBack(t *testing.T) {
+    saver := &ledgerDB{keys: make(map[string]bool)}
+    opts := ingest.Options{IdempotencyKey: ingest.KeyMessage}
+    c := &Consumer{writer: &fakeWriter{}, ingest: ingest.NewService(saver, cache.NewCache(10, 0), opts), retry: newRetryPolicy(&config.Config{})}
+
+    a := validOrder("1")
+    b := validOrder("1")
+    b.Delivery.City = "Haifa"
+    valueA, _ := json.Marshal(a)
+    valueB, _ := json.Marshal(b)
+
+    // A -> B -> A, then a redelivery of the last message
+    msgs := []kafka.Message{
+        {Topic: "orders", Offset: 0, Value: valueA},
+        {Topic: "orders", Offset: 1, Value: valueB},
+        {Topic: "orders", Offset: 2, Value: valueA},
+        {Topic: "orders", Offset: 2, Value: valueA},
+    }
+    for _, m := range msgs {
+        if err := c.handleMessage(context.Background(), m); err != nil {
+            t.Fatalf("unexpected error: %v", err)
+        }
+    }
+
+    if len(saver.saved) != 3 {
+        t.Fatalf("expected 3 saves, got %d", len(saver.saved))
+    }
+    if city := saver.saved[2].Delivery.City; city != a.Delivery.City {
+        t.Errorf("expected the order to be changed back, got city %q", city)
+    }
+}
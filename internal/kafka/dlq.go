@@ -0,0 +1,163 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/model"
+	"github.com/112Alex/demo-service.git/internal/rules"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers attached to dead-lettered messages. The original position headers
+// are also set on the first hop to a retry tier, so they always point to
+// where the message was first consumed.
+const (
+	HeaderFailureReason     = "x-failure-reason"
+	HeaderErrorClass        = "x-error-class"
+	HeaderAttempts          = "x-attempts"
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderConsumerGroup     = "x-consumer-group"
+	HeaderFailedAt          = "x-failed-at"
+	// HeaderValidationErrors carries model.ValidationErrors as JSON for invalid orders.
+	HeaderValidationErrors = "x-validation-errors"
+	// HeaderRuleViolations carries rules.Violations as JSON for orders breaking business rules.
+	HeaderRuleViolations = "x-rule-violations"
+)
+
+// failureHeaders are all headers describing a failure; they are replaced when
+// a message is dead-lettered and, except for positionHeaders, dropped when it is replayed.
+var failureHeaders = []string{
+	HeaderFailureReason, HeaderErrorClass, HeaderAttempts, HeaderOriginalTopic, HeaderOriginalPartition,
+	HeaderOriginalOffset, HeaderConsumerGroup, HeaderFailedAt, HeaderValidationErrors, HeaderRuleViolations,
+	headerRetryAttempt, headerRetryDue, headerRetryParkedAt,
+}
+
+// positionHeaders record where a message was first consumed, see originalPosition.
+// A replayed message keeps them, so it keeps its idempotency key as well.
+var positionHeaders = []string{HeaderOriginalTopic, HeaderOriginalPartition, HeaderOriginalOffset}
+
+// ErrorClassInvalid marks messages that failed decoding or validation.
+// Storage failures use the db.ErrorClass values.
+const ErrorClassInvalid = "invalid"
+
+// consumerGroupID is the consumer group of the main topic reader; each retry
+// tier reader has a group of its own, see retryGroupID.
+const consumerGroupID = "order-consumer-group"
+
+// DLQMetadata describes why and where a message died. It is carried in
+// headers of dead-lettered messages; tooling reading the dead topic should
+// use ParseDLQMetadata.
+type DLQMetadata struct {
+	Reason            string    `json:"reason"`
+	ErrorClass        string    `json:"error_class"`
+	Attempts          int       `json:"attempts"`
+	OriginalTopic     string    `json:"original_topic"`
+	OriginalPartition int       `json:"original_partition"`
+	OriginalOffset    int64     `json:"original_offset"`
+	ConsumerGroup     string    `json:"consumer_group"`
+	FailedAt          time.Time `json:"failed_at"`
+
+	ValidationErrors model.ValidationErrors `json:"validation_errors,omitempty"`
+	RuleViolations   rules.Violations       `json:"rule_violations,omitempty"`
+}
+
+// Headers encodes the metadata as Kafka headers.
+func (md DLQMetadata) Headers() []kafka.Header {
+	headers := []kafka.Header{
+		{Key: HeaderFailureReason, Value: []byte(md.Reason)},
+		{Key: HeaderErrorClass, Value: []byte(md.ErrorClass)},
+		{Key: HeaderAttempts, Value: []byte(strconv.Itoa(md.Attempts))},
+		{Key: HeaderOriginalTopic, Value: []byte(md.OriginalTopic)},
+		{Key: HeaderOriginalPartition, Value: []byte(strconv.Itoa(md.OriginalPartition))},
+		{Key: HeaderOriginalOffset, Value: []byte(strconv.FormatInt(md.OriginalOffset, 10))},
+		{Key: HeaderConsumerGroup, Value: []byte(md.ConsumerGroup)},
+		{Key: HeaderFailedAt, Value: []byte(md.FailedAt.UTC().Format(time.RFC3339Nano))},
+	}
+	if len(md.ValidationErrors) > 0 {
+		value, _ := json.Marshal(md.ValidationErrors)
+		headers = append(headers, kafka.Header{Key: HeaderValidationErrors, Value: value})
+	}
+	if len(md.RuleViolations) > 0 {
+		value, _ := json.Marshal(md.RuleViolations)
+		headers = append(headers, kafka.Header{Key: HeaderRuleViolations, Value: value})
+	}
+	return headers
+}
+
+// ParseDLQMetadata decodes metadata from headers of a dead-lettered message.
+// Missing or malformed headers leave the corresponding fields zero.
+func ParseDLQMetadata(headers []kafka.Header) DLQMetadata {
+	md := DLQMetadata{
+		Reason:        headerValue(headers, HeaderFailureReason),
+		ErrorClass:    headerValue(headers, HeaderErrorClass),
+		OriginalTopic: headerValue(headers, HeaderOriginalTopic),
+		ConsumerGroup: headerValue(headers, HeaderConsumerGroup),
+	}
+	md.Attempts, _ = strconv.Atoi(headerValue(headers, HeaderAttempts))
+	md.OriginalPartition, _ = strconv.Atoi(headerValue(headers, HeaderOriginalPartition))
+	md.OriginalOffset, _ = strconv.ParseInt(headerValue(headers, HeaderOriginalOffset), 10, 64)
+	md.FailedAt, _ = time.Parse(time.RFC3339Nano, headerValue(headers, HeaderFailedAt))
+	if v := headerValue(headers, HeaderValidationErrors); v != "" {
+		_ = json.Unmarshal([]byte(v), &md.ValidationErrors)
+	}
+	if v := headerValue(headers, HeaderRuleViolations); v != "" {
+		_ = json.Unmarshal([]byte(v), &md.RuleViolations)
+	}
+	return md
+}
+
+// failure describes a processing failure of a message.
+type failure struct {
+	err      error
+	class    string
+	attempts int // attempts made while handling this delivery
+}
+
+// originalPosition returns where the message was first consumed: its own
+// position, or the one recorded before it went through retry tiers.
+func originalPosition(m kafka.Message) (topic string, partition int, offset int64) {
+	topic = headerValue(m.Headers, HeaderOriginalTopic)
+	if topic == "" {
+		return m.Topic, m.Partition, m.Offset
+	}
+	partition, _ = strconv.Atoi(headerValue(m.Headers, HeaderOriginalPartition))
+	offset, _ = strconv.ParseInt(headerValue(m.Headers, HeaderOriginalOffset), 10, 64)
+	return topic, partition, offset
+}
+
+// totalAttempts adds attempts of this delivery to those recorded by earlier retry tiers.
+func totalAttempts(m kafka.Message, f failure) int {
+	prev, _ := strconv.Atoi(headerValue(m.Headers, HeaderAttempts))
+	return prev + f.attempts
+}
+
+// produceToDLQ sends the original message to dead-letter topic with failure metadata.
+// Headers of the original message are kept, DLQ metadata headers are replaced.
+func (c *Consumer) produceToDLQ(ctx context.Context, m kafka.Message, f failure) error {
+	now := time.Now()
+	topic, partition, offset := originalPosition(m)
+	md := DLQMetadata{
+		Reason:            f.err.Error(),
+		ErrorClass:        f.class,
+		Attempts:          totalAttempts(m, f),
+		OriginalTopic:     topic,
+		OriginalPartition: partition,
+		OriginalOffset:    offset,
+		ConsumerGroup:     c.groupOf(m.Topic),
+		FailedAt:          now,
+	}
+	errors.As(f.err, &md.ValidationErrors)
+	errors.As(f.err, &md.RuleViolations)
+
+	headers := withoutHeaders(m.Headers, failureHeaders...)
+	headers = append(headers, md.Headers()...)
+
+	return c.publish(ctx, m, kafka.Message{Topic: c.deadTopic, Key: m.Key, Value: m.Value, Headers: headers, Time: now})
+}
@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type partitionKey struct {
+	topic     string
+	partition int
+}
+
+// partitionOffsets keeps fetched-but-uncommitted offsets of one partition in fetch order.
+type partitionOffsets struct {
+	pending []int64
+	done    map[int64]bool
+}
+
+// offsetTracker computes commit points when messages finish out of order.
+// A partition's commit point only advances over a contiguous prefix of
+// processed offsets, so an unprocessed message is never committed past.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[partitionKey]*partitionOffsets
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[partitionKey]*partitionOffsets)}
+}
+
+// track registers a fetched message. Must be called in fetch order.
+func (t *offsetTracker) track(m kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := partitionKey{m.Topic, m.Partition}
+	p, ok := t.partitions[key]
+	if ok && len(p.pending) > 0 && m.Offset <= p.pending[len(p.pending)-1] {
+		// The partition is replayed from an earlier offset (rebalance or
+		// restart of the fetch): previous bookkeeping no longer applies.
+		ok = false
+	}
+	if !ok {
+		p = &partitionOffsets{done: make(map[int64]bool)}
+		t.partitions[key] = p
+	}
+	p.pending = append(p.pending, m.Offset)
+}
+
+// markDone records a processed message and returns the message to commit
+// if the partition's contiguous processed prefix advanced.
+func (t *offsetTracker) markDone(m kafka.Message) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[partitionKey{m.Topic, m.Partition}]
+	if !ok {
+		return kafka.Message{}, false
+	}
+	p.done[m.Offset] = true
+
+	committed := int64(-1)
+	for len(p.pending) > 0 && p.done[p.pending[0]] {
+		committed = p.pending[0]
+		delete(p.done, committed)
+		p.pending = p.pending[1:]
+	}
+	if committed < 0 {
+		return kafka.Message{}, false
+	}
+	return kafka.Message{Topic: m.Topic, Partition: m.Partition, Offset: committed}, true
+}
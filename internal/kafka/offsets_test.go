@@ -0,0 +1,59 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestOffsetTracker_CommitsContiguousPrefix(t *testing.T) {
+	tr := newOffsetTracker()
+	msgs := []kafka.Message{
+		{Topic: "orders", Partition: 0, Offset: 10},
+		{Topic: "orders", Partition: 0, Offset: 11},
+		{Topic: "orders", Partition: 0, Offset: 12},
+	}
+	for _, m := range msgs {
+		tr.track(m)
+	}
+
+	// 12 and 11 finish before 10: nothing may be committed yet.
+	if _, ok := tr.markDone(msgs[2]); ok {
+		t.Error("offset 12 must not be committed before 10")
+	}
+	if _, ok := tr.markDone(msgs[1]); ok {
+		t.Error("offset 11 must not be committed before 10")
+	}
+
+	commit, ok := tr.markDone(msgs[0])
+	if !ok || commit.Offset != 12 {
+		t.Errorf("expected commit at offset 12, got %d (ok=%v)", commit.Offset, ok)
+	}
+}
+
+func TestOffsetTracker_PartitionsAreIndependent(t *testing.T) {
+	tr := newOffsetTracker()
+	p0 := kafka.Message{Topic: "orders", Partition: 0, Offset: 5}
+	p1 := kafka.Message{Topic: "orders", Partition: 1, Offset: 7}
+	tr.track(p0)
+	tr.track(p1)
+
+	commit, ok := tr.markDone(p1)
+	if !ok || commit.Partition != 1 || commit.Offset != 7 {
+		t.Errorf("expected commit of partition 1 offset 7, got %d/%d (ok=%v)", commit.Partition, commit.Offset, ok)
+	}
+}
+
+func TestOffsetTracker_ResetOnReplay(t *testing.T) {
+	tr := newOffsetTracker()
+	tr.track(kafka.Message{Partition: 0, Offset: 3})
+	tr.track(kafka.Message{Partition: 0, Offset: 4})
+
+	// Offset 3 never completed; after a rebalance the partition is fetched again from 3.
+	replay := kafka.Message{Partition: 0, Offset: 3}
+	tr.track(replay)
+	commit, ok := tr.markDone(replay)
+	if !ok || commit.Offset != 3 {
+		t.Errorf("expected commit at offset 3, got %d (ok=%v)", commit.Offset, ok)
+	}
+}
@@ -0,0 +1,134 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/health"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// publish writes a message to the DLQ or a retry topic on behalf of source.
+// Failed writes are retried with c.publishRetry until they succeed or ctx is
+// cancelled; meanwhile the gate pauses fetching of new messages, so a message
+// is never left behind uncommitted while the consumer moves on.
+func (c *Consumer) publish(ctx context.Context, source, out kafka.Message) error {
+	stuck := false
+	defer func() {
+		if stuck {
+			c.gate.release(source)
+		}
+	}()
+
+	return c.publishRetry.Do(ctx, func(attempt int) error {
+		err := c.writer.WriteMessages(ctx, out)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Ошибка записи сообщения partition %d offset %d в %s, попытка %d: %v", source.Partition, source.Offset, out.Topic, attempt, err)
+			if !stuck {
+				stuck = true
+				log.Printf("Топик %s недоступен, чтение новых сообщений приостановлено", out.Topic)
+			}
+			c.gate.hold(source, out.Topic, err)
+		}
+		return err
+	}, func(error) bool { return ctx.Err() == nil })
+}
+
+// stuckMessage is a consumed message whose DLQ or retry write keeps failing.
+type stuckMessage struct {
+	Topic     string    `json:"topic"`
+	Partition int       `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Target    string    `json:"target"`
+	Since     time.Time `json:"since"`
+	Failures  int       `json:"failures"`
+	LastError string    `json:"last_error"`
+}
+
+// publishGate pauses consumption while writes to the DLQ or retry topics fail.
+// The zero value is an open gate.
+type publishGate struct {
+	mu      sync.Mutex
+	stuck   map[string]*stuckMessage
+	resumed chan struct{} // closed when the gate opens again; nil while open
+}
+
+// hold records a failed write of source and closes the gate.
+func (g *publishGate) hold(source kafka.Message, target string, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.stuck == nil {
+		g.stuck = make(map[string]*stuckMessage)
+	}
+	key := fmt.Sprintf("%s/%d/%d", source.Topic, source.Partition, source.Offset)
+	sm, ok := g.stuck[key]
+	if !ok {
+		sm = &stuckMessage{Topic: source.Topic, Partition: source.Partition, Offset: source.Offset, Target: target, Since: time.Now()}
+		g.stuck[key] = sm
+	}
+	sm.Failures++
+	sm.LastError = err.Error()
+
+	if g.resumed == nil {
+		g.resumed = make(chan struct{})
+	}
+}
+
+// release forgets source once its write succeeded, opening the gate when nothing is stuck.
+func (g *publishGate) release(source kafka.Message) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.stuck, fmt.Sprintf("%s/%d/%d", source.Topic, source.Partition, source.Offset))
+	if len(g.stuck) == 0 && g.resumed != nil {
+		close(g.resumed)
+		g.resumed = nil
+		log.Println("Запись в DLQ восстановлена, чтение сообщений возобновлено")
+	}
+}
+
+// wait blocks while the gate is closed.
+func (g *publishGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+
+	if resumed == nil {
+		return ctx.Err()
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Health reports whether consumption is paused by failing DLQ or retry writes.
+func (c *Consumer) Health() health.Report {
+	c.gate.mu.Lock()
+	defer c.gate.mu.Unlock()
+
+	if len(c.gate.stuck) == 0 {
+		return health.Report{Status: health.StatusUp, Details: map[string]interface{}{"paused": false}}
+	}
+
+	stuck := make([]stuckMessage, 0, len(c.gate.stuck))
+	for _, sm := range c.gate.stuck {
+		stuck = append(stuck, *sm)
+	}
+	sort.Slice(stuck, func(i, j int) bool { return stuck[i].Since.Before(stuck[j].Since) })
+	return health.Report{
+		Status: health.StatusDegraded,
+		Details: map[string]interface{}{
+			"paused": true,
+			"stuck":  stuck,
+		},
+	}
+}
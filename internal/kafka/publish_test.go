@@ -0,0 +1,110 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/health"
+	"github.com/112Alex/demo-service.git/internal/retry"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// unavailableWriter fails until it is made available.
+type unavailableWriter struct {
+	mu        sync.Mutex
+	available bool
+	failures  int
+	written   []kafka.Message
+}
+
+func (w *unavailableWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.available {
+		w.failures++
+		return errors.New("leader not available")
+	}
+	w.written = append(w.written, msgs...)
+	return nil
+}
+
+func (w *unavailableWriter) Close() error { return nil }
+
+func (w *unavailableWriter) state() (failures, written int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.failures, len(w.written)
+}
+
+func TestConsumer_DLQUnavailablePausesConsumption(t *testing.T) {
+	writer := &unavailableWriter{}
+	c := &Consumer{
+		writer:       writer,
+		deadTopic:    "orders-dlq",
+		publishRetry: retry.Policy{MaxAttempts: math.MaxInt, InitialDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond},
+	}
+	m := kafka.Message{Topic: "orders", Partition: 1, Offset: 7, Value: []byte("not json")}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.produceToDLQ(context.Background(), m, failure{err: errors.New("bad"), class: ErrorClassInvalid, attempts: 1})
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for failures, _ := writer.state(); failures < 3; failures, _ = writer.state() {
+		if time.Now().After(deadline) {
+			t.Fatal("DLQ write was not retried")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	rep := c.Health()
+	if rep.Status != health.StatusDegraded {
+		t.Errorf("expected degraded health while DLQ is unavailable, got %s", rep.Status)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	if err := c.gate.wait(ctx); err == nil {
+		t.Error("expected consumption to be paused")
+	}
+	cancel()
+
+	writer.mu.Lock()
+	writer.available = true
+	writer.mu.Unlock()
+
+	if err := <-done; err != nil {
+		t.Fatalf("expected DLQ write to succeed eventually, got %v", err)
+	}
+	if _, written := writer.state(); written != 1 {
+		t.Errorf("expected 1 message in DLQ, got %d", written)
+	}
+	if rep := c.Health(); rep.Status != health.StatusUp {
+		t.Errorf("expected health to recover, got %s", rep.Status)
+	}
+	if err := c.gate.wait(context.Background()); err != nil {
+		t.Errorf("expected consumption to resume, got %v", err)
+	}
+}
+
+func TestConsumer_PublishStopsOnShutdown(t *testing.T) {
+	c := &Consumer{
+		writer:       &unavailableWriter{},
+		deadTopic:    "orders-dlq",
+		publishRetry: retry.Policy{MaxAttempts: math.MaxInt, InitialDelay: time.Millisecond},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := c.produceToDLQ(ctx, kafka.Message{Topic: "orders"}, failure{err: errors.New("bad"), class: ErrorClassInvalid})
+	if err == nil {
+		t.Error("expected an error on shutdown")
+	}
+	if rep := c.Health(); rep.Status != health.StatusUp {
+		t.Errorf("expected abandoned write to be released, got %s", rep.Status)
+	}
+}
@@ -0,0 +1,409 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/config"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// DefaultReplayLimit bounds the number of DLQ messages listed or replayed at once.
+const DefaultReplayLimit = 100
+
+// DefaultReplayTimeout bounds listing and replaying the DLQ: reading a partition
+// blocks until its last offset arrives, which may never happen.
+const DefaultReplayTimeout = time.Minute
+
+// headerReplayedFrom marks a republished message with its position in the dead topic.
+const headerReplayedFrom = "x-replayed-from"
+
+// headerReplayedAt marks a replay marker: a message without value that Replay appends
+// to the dead topic for every replayed message, which x-replayed-from points to.
+// Markers are the only record of replays, the dead topic itself is never changed.
+const headerReplayedAt = "x-replayed-at"
+
+// Position identifies a message in the dead-letter topic.
+type Position struct {
+	Partition int   `json:"partition"`
+	Offset    int64 `json:"offset"`
+}
+
+// ReplayFilter selects dead-lettered messages. Empty fields do not filter.
+type ReplayFilter struct {
+	Reason    string     `json:"reason,omitempty"` // case-insensitive substring of the failure reason
+	OrderUID  string     `json:"order_uid,omitempty"`
+	From      time.Time  `json:"from,omitempty"` // failed at or after, inclusive
+	To        time.Time  `json:"to,omitempty"`   // failed before, exclusive
+	Positions []Position `json:"positions,omitempty"`
+	Limit     int        `json:"limit,omitempty"`
+	// IncludeReplayed also selects messages that were already replayed.
+	IncludeReplayed bool `json:"include_replayed,omitempty"`
+}
+
+// DLQMessage is a dead-lettered message with its decoded failure metadata.
+type DLQMessage struct {
+	Position
+	OrderUID string          `json:"order_uid"`
+	Metadata DLQMetadata     `json:"metadata"`
+	Value    json.RawMessage `json:"value,omitempty"`
+	// ReplayedAt is the time of the last replay of the message; zero if it was not replayed.
+	ReplayedAt time.Time `json:"replayed_at,omitzero"`
+
+	msg kafka.Message
+}
+
+// ReplayResult reports which messages were (or, in dry-run mode, would be) republished.
+type ReplayResult struct {
+	DryRun   bool         `json:"dry_run"`
+	Messages []DLQMessage `json:"messages"`
+}
+
+// partitionReader reads a single partition sequentially.
+type partitionReader interface {
+	ReadMessage(ctx context.Context) (kafka.Message, error)
+	Close() error
+}
+
+// dlqSource gives access to the partitions of the dead topic.
+type dlqSource interface {
+	// offsets returns the first and last (high watermark) offsets of every partition.
+	offsets(ctx context.Context) ([]kafka.PartitionOffsets, error)
+	// open returns a reader positioned at offset of the partition.
+	open(partition int, offset int64) (partitionReader, error)
+}
+
+// DLQ lists and replays messages of the dead-letter topic. It does not join
+// the consumer group and does not commit offsets, so the dead topic is
+// read from the beginning on every call.
+type DLQ struct {
+	source    dlqSource
+	writer    messageWriter
+	mainTopic string
+	deadTopic string
+}
+
+// NewDLQ creates a DLQ browser for the dead topic and a writer to the main topic from config.
+func NewDLQ(cfg *config.Config) *DLQ {
+	return &DLQ{
+		source: &brokerSource{
+			client:  &kafka.Client{Addr: kafka.TCP(cfg.KafkaBrokers...)},
+			brokers: cfg.KafkaBrokers,
+			topic:   cfg.KafkaDeadTopic,
+		},
+		writer: &kafka.Writer{
+			Addr:     kafka.TCP(cfg.KafkaBrokers...),
+			Balancer: &markerBalancer{},
+		},
+		mainTopic: cfg.KafkaTopic,
+		deadTopic: cfg.KafkaDeadTopic,
+	}
+}
+
+// Close releases the writer.
+func (d *DLQ) Close() error {
+	return d.writer.Close()
+}
+
+// List returns dead-lettered messages matching the filter, oldest first within a partition.
+// Messages that were already replayed are skipped unless f.IncludeReplayed is set.
+func (d *DLQ) List(ctx context.Context, f ReplayFilter) ([]DLQMessage, error) {
+	limit := f.Limit
+	if limit <= 0 {
+		limit = DefaultReplayLimit
+	}
+
+	partitions, err := d.source.offsets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []DLQMessage
+	for _, p := range partitions {
+		if p.FirstOffset >= p.LastOffset || !f.wantsPartition(p.Partition) {
+			continue
+		}
+		// A marker follows the message it marks in the same partition (see markerBalancer),
+		// so the partition is read to the end before its replayed messages are known.
+		var matched []DLQMessage
+		replayed := make(map[int64]time.Time)
+		err := d.readPartition(ctx, p, func(m kafka.Message) bool {
+			if pos, at, ok := parseMarker(m); ok {
+				if pos.Partition == p.Partition {
+					replayed[pos.Offset] = at
+				}
+				return true
+			}
+			if msg := newDLQMessage(m); f.matches(msg) {
+				matched = append(matched, msg)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range matched {
+			if at, ok := replayed[msg.Offset]; ok {
+				if !f.IncludeReplayed {
+					continue
+				}
+				msg.ReplayedAt = at
+			}
+			found = append(found, msg)
+			if len(found) >= limit {
+				return found, nil
+			}
+		}
+	}
+	return found, nil
+}
+
+// Replay republishes matching messages to the main topic and appends a replay marker
+// for each of them to the dead topic, so they are not replayed again unless
+// f.IncludeReplayed is set. Failure metadata and
+// retry headers are dropped, so replayed messages start with a fresh attempt count;
+// the original position is kept, so a message that was in fact stored before it was
+// dead-lettered is recognized as a duplicate under the message idempotency key.
+// With dryRun the matching messages are only returned.
+func (d *DLQ) Replay(ctx context.Context, f ReplayFilter, dryRun bool) (*ReplayResult, error) {
+	msgs, err := d.List(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	res := &ReplayResult{DryRun: dryRun, Messages: msgs}
+	if dryRun || len(msgs) == 0 {
+		return res, nil
+	}
+
+	drop := []string{headerReplayedFrom}
+	for _, key := range failureHeaders {
+		if !slices.Contains(positionHeaders, key) {
+			drop = append(drop, key)
+		}
+	}
+	out := make([]kafka.Message, len(msgs))
+	for i, msg := range msgs {
+		headers := withoutHeaders(msg.msg.Headers, drop...)
+		headers = append(headers, kafka.Header{
+			Key:   headerReplayedFrom,
+			Value: []byte(fmt.Sprintf("%d/%d", msg.Partition, msg.Offset)),
+		})
+		out[i] = kafka.Message{Topic: d.mainTopic, Key: msg.msg.Key, Value: msg.msg.Value, Headers: headers}
+	}
+	if err := d.writer.WriteMessages(ctx, out...); err != nil {
+		return nil, fmt.Errorf("ошибка повторной публикации сообщений DLQ: %w", err)
+	}
+
+	now := time.Now()
+	markers := make([]kafka.Message, len(msgs))
+	for i, msg := range msgs {
+		markers[i] = kafka.Message{
+			Topic: d.deadTopic,
+			Key:   msg.msg.Key,
+			Headers: []kafka.Header{
+				{Key: headerReplayedFrom, Value: []byte(fmt.Sprintf("%d/%d", msg.Partition, msg.Offset))},
+				{Key: headerReplayedAt, Value: []byte(now.Format(time.RFC3339Nano))},
+			},
+			Time: now,
+		}
+		res.Messages[i].ReplayedAt = now
+	}
+	if err := d.writer.WriteMessages(ctx, markers...); err != nil {
+		return nil, fmt.Errorf("сообщения DLQ переотправлены, но не отмечены и будут переотправлены повторно: %w", err)
+	}
+	return res, nil
+}
+
+// parseMarker returns the dead topic position and the time recorded by a replay marker;
+// ok is false for any other message.
+func parseMarker(m kafka.Message) (pos Position, at time.Time, ok bool) {
+	at, err := time.Parse(time.RFC3339Nano, headerValue(m.Headers, headerReplayedAt))
+	if err != nil {
+		return Position{}, time.Time{}, false
+	}
+	if _, err := fmt.Sscanf(headerValue(m.Headers, headerReplayedFrom), "%d/%d", &pos.Partition, &pos.Offset); err != nil {
+		return Position{}, time.Time{}, false
+	}
+	return pos, at, true
+}
+
+// markerBalancer routes replay markers to the partition of the message they mark,
+// so List reads a marker after its message; other messages are hashed by key.
+type markerBalancer struct {
+	hash kafka.Hash
+}
+
+func (b *markerBalancer) Balance(msg kafka.Message, partitions ...int) int {
+	if pos, _, ok := parseMarker(msg); ok && slices.Contains(partitions, pos.Partition) {
+		return pos.Partition
+	}
+	return b.hash.Balance(msg, partitions...)
+}
+
+// readPartition reads the partition from its first to its last offset at the
+// time of the call, stopping early when fn returns false.
+func (d *DLQ) readPartition(ctx context.Context, p kafka.PartitionOffsets, fn func(kafka.Message) bool) error {
+	r, err := d.source.open(p.Partition, p.FirstOffset)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for {
+		m, err := r.ReadMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("ошибка чтения DLQ partition %d: %w", p.Partition, err)
+		}
+		if !fn(m) || m.Offset+1 >= p.LastOffset {
+			return nil
+		}
+	}
+}
+
+// newDLQMessage decodes metadata and the order_uid of a dead-lettered message.
+func newDLQMessage(m kafka.Message) DLQMessage {
+	msg := DLQMessage{
+		Position: Position{Partition: m.Partition, Offset: m.Offset},
+		OrderUID: string(m.Key),
+		Metadata: ParseDLQMetadata(m.Headers),
+		msg:      m,
+	}
+	if json.Valid(m.Value) {
+		msg.Value = json.RawMessage(m.Value)
+		if msg.OrderUID == "" {
+			// bare payloads carry order_uid at the top level, event envelopes inside payload
+			var probe struct {
+				OrderUID string `json:"order_uid"`
+				Payload  struct {
+					OrderUID string `json:"order_uid"`
+				} `json:"payload"`
+			}
+			_ = json.Unmarshal(m.Value, &probe)
+			msg.OrderUID = probe.OrderUID
+			if msg.OrderUID == "" {
+				msg.OrderUID = probe.Payload.OrderUID
+			}
+		}
+	}
+	if msg.Metadata.FailedAt.IsZero() {
+		msg.Metadata.FailedAt = m.Time
+	}
+	return msg
+}
+
+// wantsPartition reports whether the partition may contain selected positions.
+func (f ReplayFilter) wantsPartition(partition int) bool {
+	if len(f.Positions) == 0 {
+		return true
+	}
+	for _, p := range f.Positions {
+		if p.Partition == partition {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the message satisfies all filter conditions.
+func (f ReplayFilter) matches(msg DLQMessage) bool {
+	if f.Reason != "" && !strings.Contains(strings.ToLower(msg.Metadata.Reason), strings.ToLower(f.Reason)) {
+		return false
+	}
+	if f.OrderUID != "" && msg.OrderUID != f.OrderUID {
+		return false
+	}
+	if !f.From.IsZero() && msg.Metadata.FailedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !msg.Metadata.FailedAt.Before(f.To) {
+		return false
+	}
+	if len(f.Positions) > 0 {
+		for _, p := range f.Positions {
+			if p == msg.Position {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// brokerSource reads the dead topic from Kafka brokers.
+type brokerSource struct {
+	client  *kafka.Client
+	brokers []string
+	topic   string
+}
+
+func (s *brokerSource) offsets(ctx context.Context) ([]kafka.PartitionOffsets, error) {
+	meta, err := s.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{s.topic}})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения метаданных топика %s: %w", s.topic, err)
+	}
+	if len(meta.Topics) != 1 {
+		return nil, fmt.Errorf("топик %s не найден", s.topic)
+	}
+	if err := meta.Topics[0].Error; err != nil {
+		return nil, fmt.Errorf("ошибка получения метаданных топика %s: %w", s.topic, err)
+	}
+
+	// First and last offsets are requested separately: brokers reject duplicate partitions in one request.
+	first, err := s.listOffsets(ctx, meta.Topics[0].Partitions, kafka.FirstOffsetOf)
+	if err != nil {
+		return nil, err
+	}
+	last, err := s.listOffsets(ctx, meta.Topics[0].Partitions, kafka.LastOffsetOf)
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := make([]kafka.PartitionOffsets, 0, len(first))
+	for _, p := range first {
+		p.LastOffset = last[p.Partition].LastOffset
+		partitions = append(partitions, p)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Partition < partitions[j].Partition })
+	return partitions, nil
+}
+
+// listOffsets requests one kind of offset for every partition, keyed by partition.
+func (s *brokerSource) listOffsets(ctx context.Context, partitions []kafka.Partition, kind func(int) kafka.OffsetRequest) (map[int]kafka.PartitionOffsets, error) {
+	reqs := make([]kafka.OffsetRequest, len(partitions))
+	for i, p := range partitions {
+		reqs[i] = kind(p.ID)
+	}
+	resp, err := s.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{s.topic: reqs}})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения смещений топика %s: %w", s.topic, err)
+	}
+
+	offsets := make(map[int]kafka.PartitionOffsets, len(partitions))
+	for _, p := range resp.Topics[s.topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("ошибка получения смещений partition %d: %w", p.Partition, p.Error)
+		}
+		offsets[p.Partition] = p
+	}
+	return offsets, nil
+}
+
+func (s *brokerSource) open(partition int, offset int64) (partitionReader, error) {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   s.brokers,
+		Topic:     s.topic,
+		Partition: partition,
+		MaxBytes:  10e6,
+	})
+	if err := r.SetOffset(offset); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("ошибка установки смещения %d: %w", offset, err)
+	}
+	return r, nil
+}
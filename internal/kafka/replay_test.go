@@ -0,0 +1,202 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type fakeSource struct {
+	partitions map[int][]kafka.Message
+}
+
+func (s *fakeSource) offsets(ctx context.Context) ([]kafka.PartitionOffsets, error) {
+	var res []kafka.PartitionOffsets
+	for p := 0; p < len(s.partitions); p++ {
+		res = append(res, kafka.PartitionOffsets{Partition: p, FirstOffset: 0, LastOffset: int64(len(s.partitions[p]))})
+	}
+	return res, nil
+}
+
+func (s *fakeSource) open(partition int, offset int64) (partitionReader, error) {
+	return &fakePartitionReader{msgs: s.partitions[partition][offset:]}, nil
+}
+
+type fakePartitionReader struct {
+	msgs []kafka.Message
+}
+
+func (r *fakePartitionReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	if len(r.msgs) == 0 {
+		return kafka.Message{}, errors.New("read past the end of partition")
+	}
+	m := r.msgs[0]
+	r.msgs = r.msgs[1:]
+	return m, nil
+}
+
+func (r *fakePartitionReader) Close() error { return nil }
+
+func deadMessage(partition int, offset int64, uid, reason string, failedAt time.Time) kafka.Message {
+	md := DLQMetadata{Reason: reason, ErrorClass: "permanent", Attempts: 1, OriginalTopic: "orders", FailedAt: failedAt}
+	return kafka.Message{
+		Topic:     "orders-dlq",
+		Partition: partition,
+		Offset:    offset,
+		Key:       []byte(uid),
+		Value:     []byte(`{"order_uid":"` + uid + `"}`),
+		Headers:   md.Headers(),
+	}
+}
+
+func newTestDLQ() (*DLQ, *fakeWriter) {
+	t0 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	writer := &fakeWriter{}
+	return &DLQ{
+		source: &fakeSource{partitions: map[int][]kafka.Message{
+			0: {
+				deadMessage(0, 0, "a", "duplicate key value", t0),
+				deadMessage(0, 1, "b", "connection refused", t0.Add(time.Hour)),
+			},
+			1: {
+				deadMessage(1, 0, "c", "connection refused", t0.Add(2*time.Hour)),
+			},
+		}},
+		writer:    writer,
+		mainTopic: "orders",
+		deadTopic: "orders-dlq",
+	}, writer
+}
+
+func TestDLQ_ListFilters(t *testing.T) {
+	d, _ := newTestDLQ()
+	t0 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		filter ReplayFilter
+		want   []string
+	}{
+		{"all", ReplayFilter{}, []string{"a", "b", "c"}},
+		{"reason", ReplayFilter{Reason: "Connection"}, []string{"b", "c"}},
+		{"order_uid", ReplayFilter{OrderUID: "c"}, []string{"c"}},
+		{"time range", ReplayFilter{From: t0.Add(time.Hour), To: t0.Add(2 * time.Hour)}, []string{"b"}},
+		{"positions", ReplayFilter{Positions: []Position{{Partition: 1, Offset: 0}}}, []string{"c"}},
+		{"limit", ReplayFilter{Limit: 2}, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs, err := d.List(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, m := range msgs {
+				got = append(got, m.OrderUID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDLQ_Replay(t *testing.T) {
+	d, writer := newTestDLQ()
+
+	res, err := d.Replay(context.Background(), ReplayFilter{Reason: "connection"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Messages) != 2 || len(writer.written) != 0 {
+		t.Fatalf("dry run must not publish: %d matched, %d written", len(res.Messages), len(writer.written))
+	}
+
+	if _, err := d.Replay(context.Background(), ReplayFilter{Reason: "connection"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.written) != 4 {
+		t.Fatalf("expected 2 republished messages and 2 markers, got %d", len(writer.written))
+	}
+	m := writer.written[0]
+	if m.Topic != "orders" || string(m.Key) != "b" {
+		t.Errorf("unexpected republished message %s/%s", m.Topic, m.Key)
+	}
+	if headerValue(m.Headers, HeaderFailureReason) != "" || headerValue(m.Headers, HeaderAttempts) != "" {
+		t.Error("failure metadata must be dropped on replay")
+	}
+	if got := headerValue(m.Headers, HeaderOriginalTopic); got != "orders" {
+		t.Errorf("the original position must be kept on replay, got topic %q", got)
+	}
+	if got := headerValue(m.Headers, headerReplayedFrom); got != "0/1" {
+		t.Errorf("expected replay source 0/1, got %q", got)
+	}
+}
+
+func TestDLQ_ReplaySkipsReplayed(t *testing.T) {
+	d, writer := newTestDLQ()
+	source := d.source.(*fakeSource)
+	filter := ReplayFilter{Reason: "connection"}
+
+	if _, err := d.Replay(context.Background(), filter, false); err != nil {
+		t.Fatal(err)
+	}
+	// markers land in the dead topic after the messages they mark
+	for _, m := range writer.written {
+		if m.Topic != "orders-dlq" {
+			continue
+		}
+		p := (&markerBalancer{}).Balance(m, 0, 1)
+		m.Partition, m.Offset = p, int64(len(source.partitions[p]))
+		source.partitions[p] = append(source.partitions[p], m)
+	}
+
+	res, err := d.Replay(context.Background(), filter, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Messages) != 0 {
+		t.Fatalf("expected replayed messages to be skipped, got %d", len(res.Messages))
+	}
+
+	all, err := d.List(context.Background(), ReplayFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].OrderUID != "a" {
+		t.Fatalf("expected only the message that was not replayed, got %+v", all)
+	}
+
+	filter.IncludeReplayed = true
+	res, err = d.Replay(context.Background(), filter, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Messages) != 2 || res.Messages[0].ReplayedAt.IsZero() {
+		t.Fatalf("expected 2 replayed messages with the replay time, got %+v", res.Messages)
+	}
+}
+
+func TestMarkerBalancer(t *testing.T) {
+	b := &markerBalancer{}
+	marker := kafka.Message{Key: []byte("a"), Headers: []kafka.Header{
+		{Key: headerReplayedFrom, Value: []byte("2/15")},
+		{Key: headerReplayedAt, Value: []byte(time.Now().Format(time.RFC3339Nano))},
+	}}
+	if p := b.Balance(marker, 0, 1, 2); p != 2 {
+		t.Errorf("expected the marker in partition 2, got %d", p)
+	}
+	// replayed messages carry x-replayed-from too, but are hashed by key
+	replayed := kafka.Message{Key: []byte("a"), Headers: marker.Headers[:1]}
+	if got, want := b.Balance(replayed, 0, 1, 2), (&kafka.Hash{}).Balance(replayed, 0, 1, 2); got != want {
+		t.Errorf("expected partition %d by key, got %d", want, got)
+	}
+}
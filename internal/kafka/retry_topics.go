@@ -0,0 +1,165 @@
+package kafka
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/retry"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers used by the delayed retry topology.
+const (
+	headerRetryAttempt = "x-retry-attempt" // number of retry tiers the message has been through
+	headerRetryDue     = "x-retry-due"     // RFC3339Nano time before which the message must not be processed
+	// RFC3339Nano time the message was first parked in a retry tier; an order
+	// changed after it is newer than the message, see model.Order.UnchangedSince
+	headerRetryParkedAt = "x-retry-parked-at"
+)
+
+// retryGroupID returns the consumer group of a retry tier reader. Tiers do not
+// share the main group: a group is rebalanced as a whole, so joining it with
+// readers of other topics would stall the main reader on every tier restart.
+func retryGroupID(topic string) string {
+	return consumerGroupID + "-" + topic
+}
+
+// groupOf returns the consumer group of the reader that fetches topic.
+func (c *Consumer) groupOf(topic string) string {
+	for _, tier := range c.tiers {
+		if tier.Topic == topic {
+			return retryGroupID(topic)
+		}
+	}
+	return consumerGroupID
+}
+
+// nextRetryTier returns the index of the retry tier a failed message goes to,
+// or false if it has been through all tiers and belongs in the DLQ.
+func (c *Consumer) nextRetryTier(m kafka.Message) (int, bool) {
+	attempt := retryAttempt(m)
+	return attempt, attempt < len(c.tiers)
+}
+
+// produceToRetry republishes a failed message to the given tier with its due time.
+// The original position and the accumulated attempt count travel with it for DLQ metadata.
+func (c *Consumer) produceToRetry(ctx context.Context, m kafka.Message, tier int, f failure) error {
+	now := time.Now()
+	topic, partition, offset := originalPosition(m)
+	parkedAt := headerValue(m.Headers, headerRetryParkedAt)
+	if parkedAt == "" {
+		parkedAt = now.Format(time.RFC3339Nano)
+	}
+	headers := withoutHeaders(m.Headers, headerRetryAttempt, headerRetryDue, headerRetryParkedAt,
+		HeaderAttempts, HeaderOriginalTopic, HeaderOriginalPartition, HeaderOriginalOffset)
+	headers = append(headers,
+		kafka.Header{Key: HeaderOriginalTopic, Value: []byte(topic)},
+		kafka.Header{Key: HeaderOriginalPartition, Value: []byte(strconv.Itoa(partition))},
+		kafka.Header{Key: HeaderOriginalOffset, Value: []byte(strconv.FormatInt(offset, 10))},
+		kafka.Header{Key: HeaderAttempts, Value: []byte(strconv.Itoa(totalAttempts(m, f)))},
+		kafka.Header{Key: headerRetryAttempt, Value: []byte(strconv.Itoa(tier + 1))},
+		kafka.Header{Key: headerRetryDue, Value: []byte(now.Add(c.tiers[tier].Delay).Format(time.RFC3339Nano))},
+		kafka.Header{Key: headerRetryParkedAt, Value: []byte(parkedAt)},
+	)
+
+	return c.publish(ctx, m, kafka.Message{
+		Topic:   c.tiers[tier].Topic,
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+		Time:    now,
+	})
+}
+
+// consumeRetryTier reprocesses messages of one retry tier once they are due.
+// All messages of a tier share the same delay, so they become due in topic
+// order and waiting for the head message does not delay the others.
+// On shutdown a message that is not yet due is left uncommitted.
+func (c *Consumer) consumeRetryTier(fetch, work context.Context, tier int) {
+	reader := c.retryReaders[tier]
+	log.Printf("Запуск потребителя отложенных повторов %s (задержка %s)...", c.tiers[tier].Topic, c.tiers[tier].Delay)
+
+	for {
+		if err := c.gate.wait(fetch); err != nil {
+			return
+		}
+		m, err := reader.FetchMessage(fetch)
+		if err != nil {
+			if fetch.Err() != nil {
+				return
+			}
+			log.Printf("Ошибка FetchMessage (%s): %v", c.tiers[tier].Topic, err)
+			continue
+		}
+
+		if due, err := time.Parse(time.RFC3339Nano, headerValue(m.Headers, headerRetryDue)); err == nil {
+			if err := retry.Sleep(fetch, time.Until(due)); err != nil {
+				return
+			}
+		}
+
+		// The message is committed only once it has been handled (stored,
+		// moved to the next tier or dead-lettered), so it is never skipped.
+		for attempt := 1; ; attempt++ {
+			err := c.handleMessage(work, m)
+			if err == nil {
+				break
+			}
+			log.Printf("Не удалось обработать сообщение %s offset %d: %v", c.tiers[tier].Topic, m.Offset, err)
+			if err := retry.Sleep(fetch, c.retry.Delay(attempt)); err != nil {
+				return
+			}
+		}
+
+		if err := reader.CommitMessages(work, m); err != nil {
+			log.Printf("Ошибка CommitMessages (%s): %v", c.tiers[tier].Topic, err)
+		}
+	}
+}
+
+// retryParkedAt returns when the message was first parked in a retry tier,
+// or the zero time for a message that has not been through the tiers.
+func retryParkedAt(m kafka.Message) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, headerValue(m.Headers, headerRetryParkedAt))
+	return t
+}
+
+// retryAttempt returns how many retry tiers the message has been through.
+func retryAttempt(m kafka.Message) int {
+	n, err := strconv.Atoi(headerValue(m.Headers, headerRetryAttempt))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// headerValue returns the last value of a header, or "" if it is absent.
+func headerValue(headers []kafka.Header, key string) string {
+	for i := len(headers) - 1; i >= 0; i-- {
+		if headers[i].Key == key {
+			return string(headers[i].Value)
+		}
+	}
+	return ""
+}
+
+// withoutHeaders returns a copy of headers without the given keys.
+func withoutHeaders(headers []kafka.Header, keys ...string) []kafka.Header {
+	out := make([]kafka.Header, 0, len(headers))
+	for _, h := range headers {
+		drop := false
+		for _, k := range keys {
+			if h.Key == k {
+				drop = true
+				break
+			}
+		}
+		if !drop {
+			out = append(out, h)
+		}
+	}
+	return out
+}
@@ -0,0 +1,163 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/cache"
+	"github.com/112Alex/demo-service.git/internal/config"
+	"github.com/112Alex/demo-service.git/internal/ingest"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func newTieredConsumer(writer messageWriter) *Consumer {
+	return &Consumer{
+		writer:    writer,
+		ingest:    ingest.NewService(&mockDB{saveErrCount: 1 << 30}, cache.NewCache(10, 0), ingest.Options{}),
+		retry:     newRetryPolicy(&config.Config{KafkaMaxRetries: 0}),
+		topic:     "orders",
+		deadTopic: "orders-dlq",
+		tiers: []config.RetryTier{
+			{Topic: "orders-retry-1m", Delay: time.Minute},
+			{Topic: "orders-retry-10m", Delay: 10 * time.Minute},
+		},
+	}
+}
+
+func TestConsumer_TransientFailureGoesThroughRetryTiers(t *testing.T) {
+	writer := &fakeWriter{}
+	c := newTieredConsumer(writer)
+	value, _ := json.Marshal(validOrder("1"))
+	m := kafka.Message{Topic: "orders", Partition: 2, Offset: 42, Key: []byte("1"), Value: value}
+
+	wantTopics := []string{"orders-retry-1m", "orders-retry-10m", "orders-dlq"}
+	var parkedAt string
+	for i, want := range wantTopics {
+		before := time.Now()
+		if err := c.handleMessage(context.Background(), m); err != nil {
+			t.Fatalf("step %d: unexpected error: %v", i, err)
+		}
+		m = writer.written[len(writer.written)-1]
+		if m.Topic != want {
+			t.Fatalf("step %d: expected topic %s, got %s", i, want, m.Topic)
+		}
+		if want == "orders-dlq" {
+			md := ParseDLQMetadata(m.Headers)
+			if md.OriginalTopic != "orders" || md.OriginalPartition != 2 || md.OriginalOffset != 42 {
+				t.Errorf("unexpected original position %s/%d/%d", md.OriginalTopic, md.OriginalPartition, md.OriginalOffset)
+			}
+			if md.Attempts != 3 || md.ErrorClass != "transient" {
+				t.Errorf("expected 3 transient attempts, got %d %s", md.Attempts, md.ErrorClass)
+			}
+			if md.ConsumerGroup != consumerGroupID+"-orders-retry-10m" {
+				t.Errorf("expected the group of the last tier, got %s", md.ConsumerGroup)
+			}
+			if headerValue(m.Headers, headerRetryAttempt) != "" {
+				t.Error("retry headers must not be forwarded to the DLQ")
+			}
+			break
+		}
+
+		if got := headerValue(m.Headers, headerRetryAttempt); got != strconv.Itoa(i+1) {
+			t.Errorf("step %d: expected attempt %d, got %s", i, i+1, got)
+		}
+		if got := headerValue(m.Headers, HeaderOriginalTopic); got != "orders" {
+			t.Errorf("step %d: expected original topic orders, got %s", i, got)
+		}
+		if i == 0 {
+			parkedAt = headerValue(m.Headers, headerRetryParkedAt)
+		}
+		if got := headerValue(m.Headers, headerRetryParkedAt); got == "" || got != parkedAt {
+			t.Errorf("step %d: expected the first parking time %q to be kept, got %q", i, parkedAt, got)
+		}
+		due, err := time.Parse(time.RFC3339Nano, headerValue(m.Headers, headerRetryDue))
+		if err != nil || due.Before(before.Add(c.tiers[i].Delay)) {
+			t.Errorf("step %d: unexpected due time %v (%v)", i, due, err)
+		}
+		m.Topic = c.tiers[i].Topic // as fetched from the tier topic
+	}
+}
+
+func TestConsumer_LostAckRetriedThroughTierIsDuplicate(t *testing.T) {
+	for _, strategy := range []ingest.KeyStrategy{ingest.KeyContent, ingest.KeyMessage} {
+		t.Run(string(strategy), func(t *testing.T) {
+			writer := &fakeWriter{}
+			saver := &ledgerDB{keys: make(map[string]bool), lostAcks: 1}
+			c := newTieredConsumer(writer)
+			c.ingest = ingest.NewService(saver, cache.NewCache(10, 0), ingest.Options{IdempotencyKey: strategy})
+
+			value, _ := json.Marshal(validOrder("1"))
+			m := kafka.Message{Topic: "orders", Partition: 2, Offset: 42, Key: []byte("1"), Value: value}
+			if err := c.handleMessage(context.Background(), m); err != nil {
+				t.Fatal(err)
+			}
+			if len(writer.written) != 1 || writer.written[0].Topic != "orders-retry-1m" {
+				t.Fatalf("expected the message in the first tier, got %+v", writer.written)
+			}
+
+			m = writer.written[0]
+			m.Partition, m.Offset = 0, 7 // as fetched from the tier topic
+			if err := c.handleMessage(context.Background(), m); err != nil {
+				t.Fatal(err)
+			}
+			if len(saver.saved) != 1 {
+				t.Errorf("expected the order to be stored once, got %d", len(saver.saved))
+			}
+			if len(writer.written) != 1 {
+				t.Errorf("expected the retry to be skipped as a duplicate, got %d published", len(writer.written))
+			}
+		})
+	}
+}
+
+func TestConsumer_LostAckRefundRetriedThroughTierIsDuplicate(t *testing.T) {
+	writer := &fakeWriter{}
+	saver := &ledgerDB{keys: make(map[string]bool), lostAcks: 1}
+	c := newTieredConsumer(writer)
+	c.ingest = ingest.NewService(saver, cache.NewCache(10, 0), ingest.Options{})
+
+	// no refund_id: the refund is keyed by its message
+	m := kafka.Message{
+		Topic: "orders", Partition: 2, Offset: 42, Key: []byte("1"),
+		Value:   []byte(`{"order_uid":"1","amount":100}`),
+		Headers: []kafka.Header{{Key: HeaderEventType, Value: []byte(ingest.EventPaymentRefunded)}},
+	}
+	if err := c.handleMessage(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.written) != 1 {
+		t.Fatalf("expected the message in the first tier, got %d published", len(writer.written))
+	}
+
+	m = writer.written[0]
+	m.Topic, m.Partition, m.Offset = "orders-retry-1m", 0, 7
+	if err := c.handleMessage(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+	if len(saver.refunds) != 1 || len(writer.written) != 1 {
+		t.Errorf("expected the refund to be recorded once, got %d recorded, %d published", len(saver.refunds), len(writer.written))
+	}
+}
+
+func TestConsumer_TierRetryCarriesParkingTime(t *testing.T) {
+	saver := &ledgerDB{keys: make(map[string]bool)}
+	c := newTieredConsumer(&fakeWriter{})
+	c.ingest = ingest.NewService(saver, cache.NewCache(10, 0), ingest.Options{})
+
+	parkedAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	value, _ := json.Marshal(validOrder("1"))
+	m := kafka.Message{Topic: "orders-retry-1m", Offset: 7, Key: []byte("1"), Value: value, Headers: []kafka.Header{
+		{Key: headerRetryAttempt, Value: []byte("1")},
+		{Key: headerRetryParkedAt, Value: []byte(parkedAt.Format(time.RFC3339Nano))},
+	}}
+	if err := c.handleMessage(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+	if len(saver.saved) != 1 || !saver.saved[0].UnchangedSince.Equal(parkedAt) {
+		t.Fatalf("expected the order to be saved unless changed since %v, got %+v", parkedAt, saver.saved)
+	}
+}
@@ -0,0 +1,117 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// lifecycle coordinates StartConsumption with Shutdown.
+type lifecycle struct {
+	once      sync.Once
+	stopOnce  sync.Once
+	abortOnce sync.Once
+	mu        sync.Mutex
+	started   bool
+	stop      chan struct{} // closed by Shutdown: stop fetching and drain
+	abort     chan struct{} // closed when the drain deadline passes: cancel in-flight work
+	done      chan struct{} // closed when StartConsumption returns
+	err       error         // errors closing the readers and the writer
+
+	failOnce  sync.Once
+	failure   error  // first panic of a consumption goroutine, see guard
+	cancelRun func() // cancels both contexts of the run
+}
+
+func (c *Consumer) lifecycle() *lifecycle {
+	c.life.once.Do(func() {
+		c.life.stop = make(chan struct{})
+		c.life.abort = make(chan struct{})
+		c.life.done = make(chan struct{})
+	})
+	return &c.life
+}
+
+// run derives the contexts of a consumption run from ctx: fetching stops on
+// Shutdown, while processing and commits go on until the drain deadline.
+// Cancelling ctx stops both.
+func (l *lifecycle) run(ctx context.Context) (fetch, work context.Context, cancel func()) {
+	fetch, stopFetch := context.WithCancel(ctx)
+	work, stopWork := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-l.stop:
+			stopFetch()
+		case <-fetch.Done():
+		}
+	}()
+	go func() {
+		select {
+		case <-l.abort:
+			stopWork()
+		case <-work.Done():
+		}
+	}()
+	cancel = func() {
+		stopFetch()
+		stopWork()
+	}
+	l.mu.Lock()
+	l.started = true
+	l.cancelRun = cancel
+	l.mu.Unlock()
+	return fetch, work, cancel
+}
+
+// guard runs fn of a consumption goroutine. A panic fails the whole run: fetching
+// and in-flight work are cancelled, uncommitted messages will be redelivered and
+// StartConsumption returns the error, so the consumer can be restarted.
+func (l *lifecycle) guard(name string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.fail(fmt.Errorf("паника в %s: %v", name, r))
+		}
+	}()
+	fn()
+}
+
+func (l *lifecycle) fail(err error) {
+	l.failOnce.Do(func() {
+		log.Printf("Потребитель Kafka аварийно остановлен: %v", err)
+		l.mu.Lock()
+		l.failure = err
+		cancel := l.cancelRun
+		l.mu.Unlock()
+		cancel()
+	})
+}
+
+// Shutdown stops fetching new messages and waits until the messages being processed
+// are finished and their offsets committed, and the readers and the writer are closed.
+// Queued messages that were not started are left uncommitted for redelivery.
+// If ctx is done first, in-flight work is cancelled and an error is returned:
+// the shutdown is unclean and the cancelled messages will be redelivered.
+func (c *Consumer) Shutdown(ctx context.Context) error {
+	l := c.lifecycle()
+	l.stopOnce.Do(func() { close(l.stop) })
+	l.mu.Lock()
+	started := l.started
+	l.mu.Unlock()
+	if !started {
+		// StartConsumption called later returns right away
+		return nil
+	}
+
+	select {
+	case <-l.done:
+		return l.err
+	case <-ctx.Done():
+	}
+
+	log.Println("Потребитель Kafka не успел завершить обработку, прерываем")
+	l.abortOnce.Do(func() { close(l.abort) })
+	<-l.done
+	return errors.Join(fmt.Errorf("потребитель Kafka не завершил обработку: %w", ctx.Err()), l.err)
+}
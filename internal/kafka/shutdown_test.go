@@ -0,0 +1,182 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/cache"
+	"github.com/112Alex/demo-service.git/internal/config"
+	"github.com/112Alex/demo-service.git/internal/ingest"
+	"github.com/112Alex/demo-service.git/internal/model"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// chanReader serves messages sent to msgs and records commits.
+type chanReader struct {
+	msgs chan kafka.Message
+
+	mu        sync.Mutex
+	committed []kafka.Message
+	closed    bool
+}
+
+func (r *chanReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case m := <-r.msgs:
+		return m, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (r *chanReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.committed = append(r.committed, msgs...)
+	return nil
+}
+
+func (r *chanReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+// blockingDB blocks SaveOrder until release is closed or ctx is done.
+type blockingDB struct {
+	mockDB
+	started chan struct{}
+	release chan struct{}
+}
+
+func (m *blockingDB) SaveOrder(ctx context.Context, o *model.Order) error {
+	m.started <- struct{}{}
+	select {
+	case <-m.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func newDrainConsumer(saver ingest.OrderSaver) (*Consumer, *chanReader) {
+	reader := &chanReader{msgs: make(chan kafka.Message, 1)}
+	return &Consumer{
+		reader:  reader,
+		writer:  &fakeWriter{},
+		ingest:  ingest.NewService(saver, cache.NewCache(10, 0), ingest.Options{}),
+		offsets: newOffsetTracker(),
+		workers: 1,
+		retry:   newRetryPolicy(&config.Config{}),
+	}, reader
+}
+
+func TestConsumer_ShutdownDrainsInFlightMessage(t *testing.T) {
+	saver := &blockingDB{started: make(chan struct{}), release: make(chan struct{})}
+	c, reader := newDrainConsumer(saver)
+	go c.StartConsumption(context.Background())
+
+	reader.msgs <- orderMessage(t, 0, "1")
+	<-saver.started
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownErr <- c.Shutdown(ctx)
+	}()
+
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown returned before the in-flight message was stored: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(saver.release)
+
+	if err := <-shutdownErr; err != nil {
+		t.Fatalf("expected clean shutdown, got %v", err)
+	}
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+	if len(reader.committed) != 1 || reader.committed[0].Offset != 0 {
+		t.Errorf("expected offset 0 to be committed, got %v", reader.committed)
+	}
+	if !reader.closed {
+		t.Error("expected reader to be closed")
+	}
+}
+
+func TestConsumer_ShutdownDeadline(t *testing.T) {
+	saver := &blockingDB{started: make(chan struct{}), release: make(chan struct{})}
+	c, reader := newDrainConsumer(saver)
+	go c.StartConsumption(context.Background())
+
+	reader.msgs <- orderMessage(t, 0, "1")
+	<-saver.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Shutdown(ctx); err == nil {
+		t.Fatal("expected an error when the drain deadline passes")
+	}
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+	if len(reader.committed) != 0 {
+		t.Errorf("expected the cancelled message to stay uncommitted, got %v", reader.committed)
+	}
+	if !reader.closed {
+		t.Error("expected reader to be closed")
+	}
+}
+
+func TestConsumer_ShutdownNotStarted(t *testing.T) {
+	c, _ := newDrainConsumer(&mockDB{})
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Errorf("expected nil for a consumer that was not started, got %v", err)
+	}
+}
+
+// panickingDB panics while saving an order.
+type panickingDB struct {
+	mockDB
+}
+
+func (m *panickingDB) SaveOrder(ctx context.Context, o *model.Order) error {
+	panic("nil pointer")
+}
+
+func (m *panickingDB) SaveOrders(ctx context.Context, orders []*model.Order) ([]error, error) {
+	panic("nil pointer")
+}
+
+func TestConsumer_PanicStopsConsumption(t *testing.T) {
+	for _, batchSize := range []int{1, 2} {
+		c, reader := newDrainConsumer(&panickingDB{})
+		c.batchSize, c.batchTimeout = batchSize, time.Millisecond
+		done := make(chan error, 1)
+		go func() { done <- c.StartConsumption(context.Background()) }()
+
+		reader.msgs <- orderMessage(t, 0, "1")
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Fatalf("batch size %d: expected the panic to be returned", batchSize)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("batch size %d: consumer kept running after a panic", batchSize)
+		}
+		reader.mu.Lock()
+		if len(reader.committed) != 0 || !reader.closed {
+			t.Errorf("batch size %d: expected the message to stay uncommitted and the reader closed, got %v, closed %v",
+				batchSize, reader.committed, reader.closed)
+		}
+		reader.mu.Unlock()
+	}
+}
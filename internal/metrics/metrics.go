@@ -0,0 +1,52 @@
+// Package metrics exposes service counters via expvar at /debug/vars.
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+	"sync"
+)
+
+// IngestOrders counts ingested orders by outcome (created, duplicate, stale, quarantined, invalid).
+var IngestOrders = expvar.NewMap("ingest_orders")
+
+// RuleViolations counts business-rule violations by rule name.
+var RuleViolations = expvar.NewMap("rule_violations")
+
+// Events counts consumed Kafka events by type, then by outcome
+// (processed, skipped, invalid, retried, dead_lettered).
+var Events = expvar.NewMap("events")
+
+// Event outcomes counted by CountEvent.
+const (
+	EventProcessed    = "processed"
+	EventSkipped      = "skipped"
+	EventInvalid      = "invalid"
+	EventRetried      = "retried"
+	EventDeadLettered = "dead_lettered"
+)
+
+// EventTypeUnknown is counted instead of event types the service does not know,
+// so producers cannot grow the events map with arbitrary header values.
+const EventTypeUnknown = "unknown"
+
+var eventsMu sync.Mutex
+
+// CountEvent increments the counter of an event type and outcome.
+func CountEvent(eventType, outcome string) {
+	byOutcome, ok := Events.Get(eventType).(*expvar.Map)
+	if !ok {
+		eventsMu.Lock()
+		if byOutcome, ok = Events.Get(eventType).(*expvar.Map); !ok {
+			byOutcome = new(expvar.Map)
+			Events.Set(eventType, byOutcome)
+		}
+		eventsMu.Unlock()
+	}
+	byOutcome.Add(outcome, 1)
+}
+
+// Handler serves all published variables as JSON.
+func Handler() http.Handler {
+	return expvar.Handler()
+}
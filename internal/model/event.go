@@ -0,0 +1,15 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EventEnvelope - конверт события: тип, версия схемы содержимого и само содержимое.
+// В этом формате публикуются события outbox и принимаются события основного топика Kafka.
+type EventEnvelope struct {
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Payload    json.RawMessage `json:"payload"`
+}
@@ -0,0 +1,23 @@
+// Package modeltest provides the canonical order fixture shared by the tests of
+// the packages that handle orders.
+package modeltest
+
+import (
+	_ "embed"
+	"encoding/json"
+
+	"github.com/112Alex/demo-service.git/internal/model"
+)
+
+//go:embed testdata/order.json
+var orderJSON []byte
+
+// Order returns a fresh copy of the fixture: an order that passes model
+// validation and the built-in consistency rules.
+func Order() *model.Order {
+	var o model.Order
+	if err := json.Unmarshal(orderJSON, &o); err != nil {
+		panic("modeltest: broken fixture: " + err.Error())
+	}
+	return &o
+}
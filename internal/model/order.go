@@ -17,6 +17,22 @@ type Order struct {
 	SmID              int       `json:"sm_id" db:"sm_id"`
 	DateCreated       time.Time `json:"date_created" db:"date_created"`
 	OofShard          string    `json:"oof_shard" db:"oof_shard"`
+	// Version - версия заказа. Во входящих сообщениях необязательна: 0 означает
+	// last-writer-wins, иначе версия должна быть больше сохраненной.
+	Version   int64     `json:"version,omitempty" db:"version"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"` // заполняется при сохранении
+	// Created заполняется при сохранении: true, если заказ вставлен, а не заменил существующий.
+	Created bool `json:"-" db:"-"`
+	// Status - текущий статус заказа. Меняется только событиями StatusUpdate;
+	// в сохраняемом заказе игнорируется и заполняется при сохранении.
+	Status OrderStatus `json:"status,omitempty" db:"status"`
+	// IdempotencyKey - ключ входящего сообщения для защиты от повторной обработки.
+	// Не является частью заказа; пустой ключ отключает проверку.
+	IdempotencyKey string `json:"-" db:"-"`
+	// UnchangedSince - если задано, заказ без версии не заменяет сохраненный заказ,
+	// измененный позже этого момента. Заполняется для отложенных повторов: пока
+	// сообщение ждало, заказ могли обновить более новые сообщения.
+	UnchangedSince time.Time `json:"-" db:"-"`
 }
 
 type Delivery struct {
@@ -43,12 +59,16 @@ type Payment struct {
 	DeliveryCost int    `json:"delivery_cost" db:"delivery_cost"`
 	GoodsTotal   int    `json:"goods_total" db:"goods_total"`
 	CustomFee    int    `json:"custom_fee" db:"custom_fee"`
+	// Refunded - сумма возвратов по заказу (события PaymentRefunded).
+	// В сохраняемом заказе игнорируется.
+	Refunded int `json:"refunded,omitempty" db:"-"`
 }
 
 // Item представляет информацию о товаре в заказе
 type Item struct {
 	ChrtID      int    `json:"chrt_id" db:"chrt_id"`
 	OrderUID    string `json:"-" db:"order_uid"` // Связь с Order
+	LineNo      int    `json:"-" db:"line_no"`   // Номер строки в заказе, с 1; вместе с OrderUID - ключ
 	TrackNumber string `json:"track_number" db:"track_number"`
 	Price       int    `json:"price" db:"price"`
 	Rid         string `json:"rid" db:"rid"`
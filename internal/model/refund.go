@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// Refund - возврат оплаты заказа (событие PaymentRefunded).
+type Refund struct {
+	// RefundID - идентификатор возврата у источника. Необязателен; если задан,
+	// используется как ключ идемпотентности.
+	RefundID   string    `json:"refund_id,omitempty"`
+	OrderUID   string    `json:"order_uid"`
+	Amount     int       `json:"amount"`
+	Reason     string    `json:"reason,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"` // время возврата у источника; нулевое - время обработки
+	// IdempotencyKey - ключ входящего сообщения, см. Order.IdempotencyKey.
+	IdempotencyKey string `json:"-"`
+}
+
+// DecodeRefund разбирает событие возврата из JSON по тем же правилам, что и DecodeOrder,
+// и проверяет его.
+func DecodeRefund(data []byte, strict bool) (*Refund, error) {
+	var r Refund
+	if err := decodeJSON(data, strict, &r, "события"); err != nil {
+		return nil, err
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Validate проверяет возврат. Возвращает ValidationErrors или nil.
+func (r *Refund) Validate() error {
+	var v validator
+	v.required("order_uid", r.OrderUID)
+	if r.Amount <= 0 {
+		v.add("amount", CodeRange, "сумма возврата должна быть положительной")
+	}
+	return v.err()
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OrderStatus - статус заказа в его жизненном цикле.
+type OrderStatus string
+
+const (
+	StatusCreated   OrderStatus = "created"
+	StatusPaid      OrderStatus = "paid"
+	StatusShipped   OrderStatus = "shipped"
+	StatusDelivered OrderStatus = "delivered"
+	StatusCancelled OrderStatus = "cancelled"
+)
+
+// transitions - допустимые переходы между статусами:
+//
+//	created -> paid -> shipped -> delivered
+//	created, paid -> cancelled
+//
+// delivered и cancelled - конечные статусы.
+var transitions = map[OrderStatus][]OrderStatus{
+	StatusCreated: {StatusPaid, StatusCancelled},
+	StatusPaid:    {StatusShipped, StatusCancelled},
+	StatusShipped: {StatusDelivered},
+}
+
+// Valid сообщает, является ли s известным статусом.
+func (s OrderStatus) Valid() bool {
+	switch s {
+	case StatusCreated, StatusPaid, StatusShipped, StatusDelivered, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// CanTransition сообщает, допустим ли переход из статуса s в статус to.
+func (s OrderStatus) CanTransition(to OrderStatus) bool {
+	for _, next := range transitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusUpdate - событие изменения статуса заказа.
+type StatusUpdate struct {
+	OrderUID   string      `json:"order_uid"`
+	Status     OrderStatus `json:"status"`
+	OccurredAt time.Time   `json:"occurred_at"` // время изменения у источника; нулевое - время обработки
+	Reason     string      `json:"reason,omitempty"`
+}
+
+// DecodeStatusUpdate разбирает событие изменения статуса из JSON по тем же правилам,
+// что и DecodeOrder, и проверяет его.
+func DecodeStatusUpdate(data []byte, strict bool) (*StatusUpdate, error) {
+	var upd StatusUpdate
+	if err := decodeJSON(data, strict, &upd, "события"); err != nil {
+		return nil, err
+	}
+	if err := upd.Validate(); err != nil {
+		return nil, err
+	}
+	return &upd, nil
+}
+
+// DecodeCancellation разбирает событие отмены заказа ({"order_uid", "reason", "occurred_at"})
+// как изменение статуса на cancelled.
+func DecodeCancellation(data []byte, strict bool) (*StatusUpdate, error) {
+	var c struct {
+		OrderUID   string    `json:"order_uid"`
+		Reason     string    `json:"reason"`
+		OccurredAt time.Time `json:"occurred_at"`
+	}
+	if err := decodeJSON(data, strict, &c, "события"); err != nil {
+		return nil, err
+	}
+	upd := &StatusUpdate{OrderUID: c.OrderUID, Status: StatusCancelled, Reason: c.Reason, OccurredAt: c.OccurredAt}
+	if err := upd.Validate(); err != nil {
+		return nil, err
+	}
+	return upd, nil
+}
+
+// Validate проверяет событие. Возвращает ValidationErrors или nil.
+func (u *StatusUpdate) Validate() error {
+	var v validator
+	v.required("order_uid", u.OrderUID)
+	if v.required("status", string(u.Status)) && !u.Status.Valid() {
+		v.add("status", CodeFormat, "ожидается один из статусов: "+strings.Join(statusNames(), ", "))
+	}
+	if u.Status == StatusCreated {
+		v.add("status", CodeRange, fmt.Sprintf("статус %s присваивается при создании заказа", StatusCreated))
+	}
+	return v.err()
+}
+
+// StatusChange - запись истории статусов заказа. From пуст для создания заказа.
+type StatusChange struct {
+	From       OrderStatus `json:"from,omitempty"`
+	To         OrderStatus `json:"to"`
+	Reason     string      `json:"reason,omitempty"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	RecordedAt time.Time   `json:"recorded_at"`
+}
+
+func statusNames() []string {
+	return []string{string(StatusCreated), string(StatusPaid), string(StatusShipped), string(StatusDelivered), string(StatusCancelled)}
+}
@@ -0,0 +1,205 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// Коды ошибок валидации.
+const (
+	CodeRequired     = "required"
+	CodeFormat       = "format"
+	CodeRange        = "range"
+	CodeType         = "type"
+	CodeUnknownField = "unknown_field"
+	CodeSyntax       = "syntax"
+)
+
+// FieldError описывает ошибку одного поля. Field - путь к полю в JSON, например "items[0].price".
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors - все ошибки валидации заказа.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		if fe.Field == "" {
+			parts[i] = fe.Message
+			continue
+		}
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return "ошибка валидации заказа: " + strings.Join(parts, "; ")
+}
+
+var phoneRe = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+
+// DecodeOrder разбирает заказ из JSON. В строгом режиме неизвестные поля
+// считаются ошибкой. Ошибки разбора возвращаются как ValidationErrors.
+// Заказ не валидируется, см. Validate.
+func DecodeOrder(data []byte, strict bool) (*Order, error) {
+	var order Order
+	if err := decodeJSON(data, strict, &order, "заказа"); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// decodeJSON разбирает в v ровно одно JSON-значение; what - название значения
+// в родительном падеже для сообщения об ошибке. Ошибки возвращаются как ValidationErrors.
+func decodeJSON(data []byte, strict bool, v interface{}, what string) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return ValidationErrors{decodeError(err)}
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return ValidationErrors{{Code: CodeSyntax, Message: "лишние данные после " + what}}
+	}
+	return nil
+}
+
+// decodeError преобразует ошибку encoding/json в FieldError.
+func decodeError(err error) FieldError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return FieldError{Field: typeErr.Field, Code: CodeType, Message: fmt.Sprintf("ожидается %s, получено %s", typeErr.Type, typeErr.Value)}
+	}
+	// encoding/json не экспортирует тип ошибки неизвестного поля.
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return FieldError{Field: strings.Trim(field, `"`), Code: CodeUnknownField, Message: "неизвестное поле"}
+	}
+	return FieldError{Code: CodeSyntax, Message: "некорректный JSON: " + err.Error()}
+}
+
+// Validate проверяет обязательные поля, форматы и диапазоны значений заказа.
+// Возвращает ValidationErrors со всеми найденными ошибками или nil.
+func (o *Order) Validate() error {
+	var v validator
+
+	v.required("order_uid", o.OrderUID)
+	v.required("track_number", o.TrackNumber)
+	v.required("entry", o.Entry)
+	v.required("locale", o.Locale)
+	v.required("customer_id", o.CustomerID)
+	v.required("delivery_service", o.DeliveryService)
+	if o.DateCreated.IsZero() {
+		v.add("date_created", CodeRequired, "обязательное поле")
+	}
+	if o.Version < 0 {
+		v.add("version", CodeRange, "не может быть отрицательной")
+	}
+
+	d := o.Delivery
+	v.required("delivery.name", d.Name)
+	v.required("delivery.city", d.City)
+	v.required("delivery.address", d.Address)
+	if v.required("delivery.phone", d.Phone) && !phoneRe.MatchString(d.Phone) {
+		v.add("delivery.phone", CodeFormat, "ожидается номер телефона из 7-15 цифр, например +79991234567")
+	}
+	if d.Email != "" {
+		if addr, err := mail.ParseAddress(d.Email); err != nil || addr.Address != d.Email {
+			v.add("delivery.email", CodeFormat, "некорректный адрес электронной почты")
+		}
+	}
+
+	p := o.Payment
+	v.required("payment.transaction", p.Transaction)
+	v.required("payment.provider", p.Provider)
+	if v.required("payment.currency", p.Currency) && !IsCurrency(p.Currency) {
+		v.add("payment.currency", CodeFormat, "ожидается код валюты ISO 4217, например RUB")
+	}
+	v.nonNegative("payment.amount", p.Amount)
+	v.nonNegative("payment.delivery_cost", p.DeliveryCost)
+	v.nonNegative("payment.goods_total", p.GoodsTotal)
+	v.nonNegative("payment.custom_fee", p.CustomFee)
+	if p.PaymentDt <= 0 {
+		v.add("payment.payment_dt", CodeRequired, "обязательное поле")
+	}
+
+	if len(o.Items) == 0 {
+		v.add("items", CodeRequired, "заказ должен содержать хотя бы один товар")
+	}
+	for i, item := range o.Items {
+		prefix := fmt.Sprintf("items[%d].", i)
+		if item.ChrtID <= 0 {
+			v.add(prefix+"chrt_id", CodeRequired, "обязательное поле")
+		}
+		v.required(prefix+"name", item.Name)
+		v.nonNegative(prefix+"price", item.Price)
+		v.nonNegative(prefix+"total_price", item.TotalPrice)
+		if item.Sale < 0 || item.Sale > 100 {
+			v.add(prefix+"sale", CodeRange, "скидка должна быть от 0 до 100")
+		}
+	}
+
+	return v.err()
+}
+
+// validator накапливает ошибки полей.
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) add(field, code, message string) {
+	v.errs = append(v.errs, FieldError{Field: field, Code: code, Message: message})
+}
+
+// required проверяет, что строка не пуста, и возвращает true, если это так.
+func (v *validator) required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, CodeRequired, "обязательное поле")
+		return false
+	}
+	return true
+}
+
+func (v *validator) nonNegative(field string, value int) {
+	if value < 0 {
+		v.add(field, CodeRange, "не может быть отрицательным")
+	}
+}
+
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// IsCurrency сообщает, является ли code действующим кодом валюты ISO 4217.
+func IsCurrency(code string) bool {
+	_, ok := currencies[code]
+	return ok
+}
+
+// currencies - действующие коды валют ISO 4217.
+var currencies = func() map[string]struct{} {
+	codes := strings.Fields(`
+		AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BHD BIF BMD BND BOB BRL
+		BSD BTN BWP BYN BZD CAD CDF CHF CLP CNY COP CRC CUP CVE CZK DJF DKK DOP DZD EGP
+		ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GNF GTQ GYD HKD HNL HTG HUF IDR ILS INR
+		IQD IRR ISK JMD JOD JPY KES KGS KHR KMF KPW KRW KWD KYD KZT LAK LBP LKR LRD LSL
+		LYD MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MYR MZN NAD NGN NIO NOK NPR
+		NZD OMR PAB PEN PGK PHP PKR PLN PYG QAR RON RSD RUB RWF SAR SBD SCR SDG SEK SGD
+		SHP SLE SOS SRD SSP STN SVC SYP SZL THB TJS TMT TND TOP TRY TTD TWD TZS UAH UGX
+		USD UYU UZS VES VND VUV WST XAF XCD XCG XOF XPF YER ZAR ZMW ZWG`)
+	m := make(map[string]struct{}, len(codes))
+	for _, c := range codes {
+		m[c] = struct{}{}
+	}
+	return m
+}()
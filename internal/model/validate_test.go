@@ -0,0 +1,185 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// validOrder loads the fixture shared with the other packages (see modeltest,
+// which these tests cannot import).
+func validOrder(t *testing.T) *Order {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("modeltest", "testdata", "order.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var o Order
+	if err := json.Unmarshal(data, &o); err != nil {
+		t.Fatal(err)
+	}
+	return &o
+}
+
+func TestOrder_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(o *Order)
+		fields []string
+	}{
+		{"valid", func(o *Order) {}, nil},
+		{"missing delivery", func(o *Order) { o.Delivery = Delivery{} }, []string{"delivery.name", "delivery.city", "delivery.address", "delivery.phone"}},
+		{"missing payment", func(o *Order) { o.Payment = Payment{} }, []string{"payment.transaction", "payment.provider", "payment.currency", "payment.payment_dt"}},
+		{"no items", func(o *Order) { o.Items = nil }, []string{"items"}},
+		{"bad email", func(o *Order) { o.Delivery.Email = "not-an-email" }, []string{"delivery.email"}},
+		{"bad phone", func(o *Order) { o.Delivery.Phone = "call me" }, []string{"delivery.phone"}},
+		{"unknown currency", func(o *Order) { o.Payment.Currency = "usd" }, []string{"payment.currency"}},
+		{"negative amounts", func(o *Order) { o.Payment.Amount = -1; o.Items[0].Price = -1 }, []string{"payment.amount", "items[0].price"}},
+		{"sale out of range", func(o *Order) { o.Items[0].Sale = 101 }, []string{"items[0].sale"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := validOrder(t)
+			tt.modify(o)
+			err := o.Validate()
+			if tt.fields == nil {
+				if err != nil {
+					t.Fatalf("Ожидался корректный заказ, получено: %v", err)
+				}
+				return
+			}
+
+			var verrs ValidationErrors
+			if !errors.As(err, &verrs) {
+				t.Fatalf("Ожидались ValidationErrors, получено: %v", err)
+			}
+			if len(verrs) != len(tt.fields) {
+				t.Fatalf("Ожидались ошибки полей %v, получено: %v", tt.fields, verrs)
+			}
+			for i, field := range tt.fields {
+				if verrs[i].Field != field {
+					t.Errorf("Ожидалась ошибка поля %s, получено %s", field, verrs[i].Field)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		strict  bool
+		field   string
+		code    string
+		wantErr bool
+	}{
+		{"lenient unknown field", `{"order_uid":"1","extra":true}`, false, "", "", false},
+		{"strict unknown field", `{"order_uid":"1","extra":true}`, true, "extra", CodeUnknownField, true},
+		{"wrong type", `{"order_uid":"1","payment":{"amount":"10"}}`, false, "payment.amount", CodeType, true},
+		{"broken json", `{"order_uid":`, false, "", CodeSyntax, true},
+		{"trailing data", `{"order_uid":"1"} {}`, false, "", CodeSyntax, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeOrder([]byte(tt.data), tt.strict)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Неожиданная ошибка: %v", err)
+				}
+				return
+			}
+			var verrs ValidationErrors
+			if !errors.As(err, &verrs) || len(verrs) != 1 {
+				t.Fatalf("Ожидалась одна ошибка поля, получено: %v", err)
+			}
+			if verrs[0].Field != tt.field || verrs[0].Code != tt.code {
+				t.Errorf("Ожидалась ошибка %s/%s, получено %s/%s", tt.field, tt.code, verrs[0].Field, verrs[0].Code)
+			}
+		})
+	}
+}
+
+func TestDecodeStatusUpdate(t *testing.T) {
+	upd, err := DecodeStatusUpdate([]byte(`{"order_uid":"1","status":"paid","occurred_at":"2024-01-01T10:00:00Z"}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upd.Status != StatusPaid || upd.OccurredAt.IsZero() {
+		t.Errorf("Неверно разобрано событие: %+v", upd)
+	}
+
+	for _, payload := range []string{
+		`{"order_uid":"1","status":"lost"}`,
+		`{"order_uid":"1","status":"created"}`,
+		`{"status":"paid"}`,
+		`{"order_uid":"1","status":"paid","extra":1}`,
+	} {
+		var verrs ValidationErrors
+		if _, err := DecodeStatusUpdate([]byte(payload), true); !errors.As(err, &verrs) {
+			t.Errorf("Ожидалась ошибка валидации для %s, получено %v", payload, err)
+		}
+	}
+}
+
+func TestDecodeRefund(t *testing.T) {
+	r, err := DecodeRefund([]byte(`{"refund_id":"r1","order_uid":"1","amount":100}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.RefundID != "r1" || r.Amount != 100 {
+		t.Errorf("Неверно разобран возврат: %+v", r)
+	}
+
+	for _, payload := range []string{
+		`{"order_uid":"1","amount":0}`,
+		`{"order_uid":"1","amount":-5}`,
+		`{"amount":100}`,
+		`{"order_uid":"1","amount":100,"extra":1}`,
+	} {
+		var verrs ValidationErrors
+		if _, err := DecodeRefund([]byte(payload), true); !errors.As(err, &verrs) {
+			t.Errorf("Ожидалась ошибка валидации для %s, получено %v", payload, err)
+		}
+	}
+}
+
+func TestDecodeCancellation(t *testing.T) {
+	upd, err := DecodeCancellation([]byte(`{"order_uid":"1","reason":"передумал"}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upd.Status != StatusCancelled || upd.Reason != "передумал" {
+		t.Errorf("Неверно разобрана отмена: %+v", upd)
+	}
+	if _, err := DecodeCancellation([]byte(`{"reason":"x"}`), true); err == nil {
+		t.Error("Ожидалась ошибка для отмены без order_uid")
+	}
+}
+
+func TestOrderStatus_CanTransition(t *testing.T) {
+	tests := []struct {
+		from, to OrderStatus
+		want     bool
+	}{
+		{StatusCreated, StatusPaid, true},
+		{StatusCreated, StatusCancelled, true},
+		{StatusPaid, StatusShipped, true},
+		{StatusPaid, StatusCancelled, true},
+		{StatusShipped, StatusDelivered, true},
+		{StatusCreated, StatusShipped, false},
+		{StatusShipped, StatusCancelled, false},
+		{StatusDelivered, StatusCancelled, false},
+		{StatusCancelled, StatusPaid, false},
+		{StatusPaid, StatusPaid, false},
+	}
+	for _, tt := range tests {
+		if got := tt.from.CanTransition(tt.to); got != tt.want {
+			t.Errorf("%s -> %s: ожидалось %v, получено %v", tt.from, tt.to, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Package outbox publishes events written to the transactional outbox to Kafka.
+package outbox
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/db"
+	"github.com/112Alex/demo-service.git/internal/health"
+	"github.com/112Alex/demo-service.git/internal/retry"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers of published events.
+const (
+	HeaderEventType = "x-event-type"
+	HeaderEventID   = "x-event-id"
+)
+
+// Store reads and marks outbox events. Implemented by *db.DBClient.
+type Store interface {
+	PublishOutbox(ctx context.Context, limit int, publish func([]db.OutboxEvent) error) (int, error)
+}
+
+// Writer is the subset of *kafka.Writer used by the relay.
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// NewKafkaWriter creates a writer to the events topic. Messages are
+// partitioned by key, so events of one order land in one partition.
+func NewKafkaWriter(brokers []string, topic string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}
+}
+
+// Options configure a Relay.
+type Options struct {
+	Topic     string
+	BatchSize int           // events published per transaction
+	Interval  time.Duration // polling interval when the outbox is drained
+}
+
+// Relay polls the outbox and publishes events to Kafka.
+//
+// Delivery is at-least-once: events are marked published only after Kafka
+// acknowledged them, so a crash in between republishes them. Events are keyed
+// by order_uid and published in id order by a single instance at a time, so
+// events of one order arrive in the order they were stored.
+type Relay struct {
+	store  Store
+	writer Writer
+	opts   Options
+
+	mu          sync.Mutex
+	published   int64
+	lastPublish time.Time
+	lastErr     string
+	lastErrAt   time.Time
+}
+
+// NewRelay creates a relay.
+func NewRelay(store Store, writer Writer, opts Options) *Relay {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	return &Relay{store: store, writer: writer, opts: opts}
+}
+
+// Run publishes events until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	log.Printf("Запуск публикации событий outbox в %s...", r.opts.Topic)
+
+	for ctx.Err() == nil {
+		n, err := r.store.PublishOutbox(ctx, r.opts.BatchSize, func(events []db.OutboxEvent) error {
+			return r.writer.WriteMessages(ctx, r.messages(events)...)
+		})
+		r.record(n, err)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Ошибка публикации событий outbox: %v", err)
+		}
+
+		// A full batch means more events are likely waiting.
+		if err == nil && n == r.opts.BatchSize {
+			continue
+		}
+		if retry.Sleep(ctx, r.opts.Interval) != nil {
+			return
+		}
+	}
+}
+
+// messages converts events to Kafka messages keyed by order_uid.
+func (r *Relay) messages(events []db.OutboxEvent) []kafka.Message {
+	msgs := make([]kafka.Message, len(events))
+	for i, e := range events {
+		msgs[i] = kafka.Message{
+			Key:   []byte(e.OrderUID),
+			Value: e.Payload,
+			Headers: []kafka.Header{
+				{Key: HeaderEventType, Value: []byte(e.EventType)},
+				{Key: HeaderEventID, Value: []byte(strconv.FormatInt(e.ID, 10))},
+			},
+			Time: e.CreatedAt,
+		}
+	}
+	return msgs
+}
+
+func (r *Relay) record(n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.lastErr = err.Error()
+		r.lastErrAt = time.Now()
+		return
+	}
+	r.lastErr = ""
+	if n > 0 {
+		r.published += int64(n)
+		r.lastPublish = time.Now()
+	}
+}
+
+// Health reports the relay as degraded while publishing fails.
+func (r *Relay) Health() health.Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	details := map[string]interface{}{
+		"topic":     r.opts.Topic,
+		"published": r.published,
+	}
+	if !r.lastPublish.IsZero() {
+		details["last_published_at"] = r.lastPublish
+	}
+	if r.lastErr == "" {
+		return health.Report{Status: health.StatusUp, Details: details}
+	}
+	details["error"] = r.lastErr
+	details["last_error_at"] = r.lastErrAt
+	return health.Report{Status: health.StatusDegraded, Details: details}
+}
@@ -0,0 +1,106 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/db"
+	"github.com/112Alex/demo-service.git/internal/health"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// memStore is an in-memory outbox.
+type memStore struct {
+	mu        sync.Mutex
+	events    []db.OutboxEvent
+	published int
+}
+
+func (s *memStore) PublishOutbox(ctx context.Context, limit int, publish func([]db.OutboxEvent) error) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	end := s.published + limit
+	if end > len(s.events) {
+		end = len(s.events)
+	}
+	batch := s.events[s.published:end]
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	if err := publish(batch); err != nil {
+		return 0, err
+	}
+	s.published = end
+	return len(batch), nil
+}
+
+func (s *memStore) pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events) - s.published
+}
+
+// flakyWriter fails the first failures writes.
+type flakyWriter struct {
+	mu       sync.Mutex
+	failures int
+	written  []kafka.Message
+}
+
+func (w *flakyWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.failures > 0 {
+		w.failures--
+		return errors.New("broker not available")
+	}
+	w.written = append(w.written, msgs...)
+	return nil
+}
+
+func TestRelay_PublishesInOrderAtLeastOnce(t *testing.T) {
+	store := &memStore{}
+	for i, uid := range []string{"a", "b", "a", "c", "a"} {
+		store.events = append(store.events, db.OutboxEvent{ID: int64(i + 1), OrderUID: uid, EventType: db.EventOrderStored, Payload: []byte(`{}`)})
+	}
+	writer := &flakyWriter{failures: 2}
+	relay := NewRelay(store, writer, Options{Topic: "order-events", BatchSize: 2, Interval: time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		relay.Run(ctx)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for store.pending() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("outbox was not drained")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if len(writer.written) != 5 {
+		t.Fatalf("expected 5 published events, got %d", len(writer.written))
+	}
+	for i, m := range writer.written {
+		if got := string(m.Headers[1].Value); got != strconv.Itoa(i+1) {
+			t.Errorf("event %d published out of order: id %s", i, got)
+		}
+		if string(m.Key) != store.events[i].OrderUID {
+			t.Errorf("event %d published with key %s", i, m.Key)
+		}
+	}
+	if rep := relay.Health(); rep.Status != health.StatusUp {
+		t.Errorf("expected relay to recover, got %s", rep.Status)
+	}
+}
@@ -0,0 +1,77 @@
+package retry
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Policy describes exponential backoff with jitter.
+type Policy struct {
+	MaxAttempts  int           // total attempts including the first one; <= 0 means 1
+	InitialDelay time.Duration // delay after the first failed attempt
+	MaxDelay     time.Duration // upper bound for a single delay; 0 means unbounded
+	Multiplier   float64       // delay growth factor; < 1 means 2
+	Jitter       float64       // fraction of the delay randomized, in [0, 1]
+}
+
+// Delay returns the pause after the given failed attempt (starting at 1).
+// With jitter the delay is drawn uniformly from [d*(1-Jitter), d].
+func (p Policy) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 2
+	}
+
+	d := float64(p.InitialDelay) * math.Pow(mult, float64(attempt-1))
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	if j := math.Min(math.Max(p.Jitter, 0), 1); j > 0 {
+		d -= d * j * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// Do calls fn until it succeeds, returns an error that retryable rejects, or
+// MaxAttempts is reached. The last error of fn is returned; if ctx is cancelled
+// while waiting, ctx.Err() is returned instead.
+func (p Policy) Do(ctx context.Context, fn func(attempt int) error, retryable func(error) bool) error {
+	attempts := p.MaxAttempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = fn(attempt); err == nil || !retryable(err) {
+			return err
+		}
+		if attempt == attempts {
+			break
+		}
+		if serr := Sleep(ctx, p.Delay(attempt)); serr != nil {
+			return serr
+		}
+	}
+	return err
+}
+
+// Sleep pauses for d or until ctx is done, whichever comes first.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
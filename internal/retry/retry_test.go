@@ -0,0 +1,56 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPolicy_Delay(t *testing.T) {
+	p := Policy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second, Multiplier: 2}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+	for i, w := range want {
+		if got := p.Delay(i + 1); got != w {
+			t.Errorf("attempt %d: ожидалось %s, получено %s", i+1, w, got)
+		}
+	}
+}
+
+func TestPolicy_DelayJitter(t *testing.T) {
+	p := Policy{InitialDelay: time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if d := p.Delay(1); d < 500*time.Millisecond || d > time.Second {
+			t.Fatalf("задержка %s вне диапазона [500ms, 1s]", d)
+		}
+	}
+}
+
+func TestPolicy_Do(t *testing.T) {
+	errTransient := errors.New("transient")
+	errPermanent := errors.New("permanent")
+	retryable := func(err error) bool { return errors.Is(err, errTransient) }
+	p := Policy{MaxAttempts: 3, InitialDelay: time.Millisecond}
+
+	calls := 0
+	err := p.Do(context.Background(), func(int) error { calls++; return errTransient }, retryable)
+	if !errors.Is(err, errTransient) || calls != 3 {
+		t.Errorf("ожидалось 3 попытки и errTransient, получено %d и %v", calls, err)
+	}
+
+	calls = 0
+	err = p.Do(context.Background(), func(int) error { calls++; return errPermanent }, retryable)
+	if !errors.Is(err, errPermanent) || calls != 1 {
+		t.Errorf("ожидалась 1 попытка и errPermanent, получено %d и %v", calls, err)
+	}
+}
+
+func TestPolicy_DoStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := Policy{MaxAttempts: 5, InitialDelay: time.Hour}
+
+	err := p.Do(ctx, func(int) error { cancel(); return errors.New("transient") }, func(error) bool { return true })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ожидалась context.Canceled, получено %v", err)
+	}
+}
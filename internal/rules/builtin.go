@@ -0,0 +1,66 @@
+package rules
+
+import (
+	"fmt"
+
+	"github.com/112Alex/demo-service.git/internal/model"
+)
+
+// Builtin returns the built-in payment and item consistency rules.
+func Builtin() []Rule {
+	return []Rule{
+		goodsTotalRule{},
+		paymentAmountRule{},
+		itemTotalPriceRule{},
+	}
+}
+
+// goodsTotalRule checks that payment.goods_total is the sum of items' total_price.
+type goodsTotalRule struct{}
+
+func (goodsTotalRule) Name() string              { return "goods_total" }
+func (goodsTotalRule) DefaultSeverity() Severity { return SeverityQuarantine }
+
+func (goodsTotalRule) Check(o *model.Order) []string {
+	sum := 0
+	for _, item := range o.Items {
+		sum += item.TotalPrice
+	}
+	if sum != o.Payment.GoodsTotal {
+		return []string{fmt.Sprintf("goods_total %d не равен сумме total_price товаров %d", o.Payment.GoodsTotal, sum)}
+	}
+	return nil
+}
+
+// paymentAmountRule checks that amount = goods_total + delivery_cost + custom_fee.
+type paymentAmountRule struct{}
+
+func (paymentAmountRule) Name() string              { return "payment_amount" }
+func (paymentAmountRule) DefaultSeverity() Severity { return SeverityQuarantine }
+
+func (paymentAmountRule) Check(o *model.Order) []string {
+	p := o.Payment
+	if want := p.GoodsTotal + p.DeliveryCost + p.CustomFee; p.Amount != want {
+		return []string{fmt.Sprintf("amount %d не равен goods_total + delivery_cost + custom_fee = %d", p.Amount, want)}
+	}
+	return nil
+}
+
+// itemTotalPriceRule checks that total_price is price reduced by sale percent.
+// Prices are integers, so the result may differ from the exact value by one
+// because of rounding on the producer side.
+type itemTotalPriceRule struct{}
+
+func (itemTotalPriceRule) Name() string              { return "item_total_price" }
+func (itemTotalPriceRule) DefaultSeverity() Severity { return SeverityWarn }
+
+func (itemTotalPriceRule) Check(o *model.Order) []string {
+	var found []string
+	for i, item := range o.Items {
+		want := float64(item.Price) * float64(100-item.Sale) / 100
+		if diff := float64(item.TotalPrice) - want; diff >= 1 || diff <= -1 {
+			found = append(found, fmt.Sprintf("items[%d]: total_price %d не соответствует price %d со скидкой %d%% (%.2f)", i, item.TotalPrice, item.Price, item.Sale, want))
+		}
+	}
+	return found
+}
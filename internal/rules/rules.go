@@ -0,0 +1,160 @@
+// Package rules implements business-rule consistency checks run during ingestion.
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/112Alex/demo-service.git/internal/model"
+)
+
+// Severity says what happens to an order violating a rule.
+type Severity string
+
+const (
+	SeverityOff        Severity = "off"        // rule is not evaluated
+	SeverityWarn       Severity = "warn"       // violation is logged and counted, the order is accepted
+	SeverityQuarantine Severity = "quarantine" // order is held for manual review
+	SeverityReject     Severity = "reject"     // order is rejected as invalid
+)
+
+// rank orders severities from the mildest to the strictest.
+func (s Severity) rank() int {
+	switch s {
+	case SeverityWarn:
+		return 1
+	case SeverityQuarantine:
+		return 2
+	case SeverityReject:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// ParseSeverity validates a severity name.
+func ParseSeverity(s string) (Severity, error) {
+	switch sev := Severity(s); sev {
+	case SeverityOff, SeverityWarn, SeverityQuarantine, SeverityReject:
+		return sev, nil
+	}
+	return "", fmt.Errorf("неизвестная строгость правила %q: ожидается off, warn, quarantine или reject", s)
+}
+
+// ParseOverrides parses a "rule=severity,rule=severity" list, for example
+// "goods_total=reject,item_total_price=off". An empty string yields no overrides.
+func ParseOverrides(spec string) (map[string]Severity, error) {
+	overrides := make(map[string]Severity)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("ожидается rule=severity, получено %q", part)
+		}
+		sev, err := ParseSeverity(value)
+		if err != nil {
+			return nil, err
+		}
+		overrides[name] = sev
+	}
+	return overrides, nil
+}
+
+// Rule is a single consistency check.
+type Rule interface {
+	// Name identifies the rule in configuration, logs and metrics.
+	Name() string
+	// DefaultSeverity is used unless configured otherwise.
+	DefaultSeverity() Severity
+	// Check returns a description of each violation found in the order.
+	Check(o *model.Order) []string
+}
+
+// Violation is a failed rule check.
+type Violation struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// Violations are all rule violations of an order. As an error it describes
+// violations that prevent the order from being stored.
+type Violations []Violation
+
+func (v Violations) Error() string {
+	parts := make([]string, len(v))
+	for i, viol := range v {
+		parts[i] = viol.Rule + ": " + viol.Message
+	}
+	return "нарушены бизнес-правила: " + strings.Join(parts, "; ")
+}
+
+// Severity returns the strictest severity among the violations.
+func (v Violations) Severity() Severity {
+	worst := SeverityOff
+	for _, viol := range v {
+		if viol.Severity.rank() > worst.rank() {
+			worst = viol.Severity
+		}
+	}
+	return worst
+}
+
+// Engine evaluates the active rules.
+type Engine struct {
+	rules      []Rule
+	severities map[string]Severity
+}
+
+// NewEngine creates an engine for the given rules. overrides sets the severity
+// of rules by name; naming an unknown rule is an error.
+func NewEngine(rules []Rule, overrides map[string]Severity) (*Engine, error) {
+	e := &Engine{rules: rules, severities: make(map[string]Severity, len(rules))}
+	for _, r := range rules {
+		e.severities[r.Name()] = r.DefaultSeverity()
+	}
+	for name, sev := range overrides {
+		if _, ok := e.severities[name]; !ok {
+			return nil, fmt.Errorf("неизвестное бизнес-правило %q, доступны: %s", name, strings.Join(e.names(), ", "))
+		}
+		e.severities[name] = sev
+	}
+	return e, nil
+}
+
+// Evaluate runs all active rules and returns their violations.
+func (e *Engine) Evaluate(o *model.Order) Violations {
+	var found Violations
+	for _, r := range e.rules {
+		sev := e.severities[r.Name()]
+		if sev == SeverityOff {
+			continue
+		}
+		for _, msg := range r.Check(o) {
+			found = append(found, Violation{Rule: r.Name(), Severity: sev, Message: msg})
+		}
+	}
+	return found
+}
+
+// Active returns the severity of every rule, for diagnostics.
+func (e *Engine) Active() map[string]Severity {
+	out := make(map[string]Severity, len(e.severities))
+	for name, sev := range e.severities {
+		out[name] = sev
+	}
+	return out
+}
+
+func (e *Engine) names() []string {
+	names := make([]string, 0, len(e.severities))
+	for name := range e.severities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,91 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/112Alex/demo-service.git/internal/model"
+	"github.com/112Alex/demo-service.git/internal/model/modeltest"
+)
+
+func TestBuiltin(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(o *model.Order)
+		rules  []string
+	}{
+		{"consistent", func(o *model.Order) {}, nil},
+		{"goods total", func(o *model.Order) { o.Payment.GoodsTotal = 300; o.Payment.Amount = 1800 }, []string{"goods_total"}},
+		{"amount", func(o *model.Order) { o.Payment.CustomFee = 10 }, []string{"payment_amount"}},
+		{"item rounding", func(o *model.Order) {
+			o.Items[0].TotalPrice = 318
+			o.Payment.GoodsTotal = 318
+			o.Payment.Amount = 1818
+		}, nil},
+		{"item total price", func(o *model.Order) {
+			o.Items[0].TotalPrice = 453
+			o.Payment.GoodsTotal = 453
+			o.Payment.Amount = 1953
+		}, []string{"item_total_price"}},
+	}
+
+	e, err := NewEngine(Builtin(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := modeltest.Order()
+			tt.modify(o)
+
+			got := e.Evaluate(o)
+			if len(got) != len(tt.rules) {
+				t.Fatalf("Ожидались нарушения %v, получено %v", tt.rules, got)
+			}
+			for i, v := range got {
+				if v.Rule != tt.rules[i] {
+					t.Errorf("Ожидалось правило %s, получено %s", tt.rules[i], v.Rule)
+				}
+			}
+		})
+	}
+}
+
+func TestEngine_Overrides(t *testing.T) {
+	overrides, err := ParseOverrides(" goods_total=reject, payment_amount=off ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewEngine(Builtin(), overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := modeltest.Order()
+	o.Payment.GoodsTotal = 0
+	got := e.Evaluate(o)
+	if len(got) != 1 || got[0].Rule != "goods_total" {
+		t.Fatalf("Ожидалось только нарушение goods_total, получено %v", got)
+	}
+	if got.Severity() != SeverityReject {
+		t.Errorf("Ожидалась строгость reject, получена %s", got.Severity())
+	}
+
+	if _, err := NewEngine(Builtin(), map[string]Severity{"no_such_rule": SeverityWarn}); err == nil {
+		t.Error("Ожидалась ошибка для неизвестного правила")
+	}
+	for _, spec := range []string{"goods_total", "goods_total=fatal", "=warn"} {
+		if _, err := ParseOverrides(spec); err == nil {
+			t.Errorf("Ожидалась ошибка разбора %q", spec)
+		}
+	}
+}
+
+func TestViolations_Severity(t *testing.T) {
+	v := Violations{{Severity: SeverityWarn}, {Severity: SeverityQuarantine}, {Severity: SeverityWarn}}
+	if got := v.Severity(); got != SeverityQuarantine {
+		t.Errorf("Ожидалась строгость quarantine, получена %s", got)
+	}
+	if got := Violations(nil).Severity(); got != SeverityOff {
+		t.Errorf("Ожидалась строгость off без нарушений, получена %s", got)
+	}
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/db"
+	"github.com/112Alex/demo-service.git/internal/kafka"
+	"github.com/112Alex/demo-service.git/internal/metrics"
+)
+
+// Admin содержит зависимости административного API.
+// Если Token пуст, эндпоинты /admin/ не регистрируются.
+type Admin struct {
+	Token string
+	DLQ   *kafka.DLQ
+}
+
+// replayRequest - тело POST /admin/dlq/replay.
+type replayRequest struct {
+	kafka.ReplayFilter
+	DryRun bool `json:"dry_run"`
+}
+
+// reviewRequest - необязательное тело запросов одобрения и отклонения заказа в карантине.
+type reviewRequest struct {
+	Note string `json:"note"`
+}
+
+// registerAdmin регистрирует административные эндпоинты под проверкой токена.
+func (s *Server) registerAdmin(router *http.ServeMux, admin Admin) {
+	if admin.Token == "" {
+		log.Println("ADMIN_TOKEN не задан, административный API отключен")
+		return
+	}
+	s.dlq = admin.DLQ
+
+	auth := requireToken(admin.Token)
+	// expvar также раскрывает cmdline и memstats процесса
+	router.Handle("GET /debug/vars", auth(metrics.Handler()))
+	router.Handle("GET /admin/dlq", auth(http.HandlerFunc(s.listDLQHandler)))
+	router.Handle("POST /admin/dlq/replay", auth(http.HandlerFunc(s.replayDLQHandler)))
+	router.Handle("GET /admin/quarantine", auth(http.HandlerFunc(s.listQuarantineHandler)))
+	router.Handle("GET /admin/quarantine/{id}", auth(http.HandlerFunc(s.getQuarantinedHandler)))
+	router.Handle("POST /admin/quarantine/{id}/approve", auth(http.HandlerFunc(s.approveQuarantinedHandler)))
+	router.Handle("POST /admin/quarantine/{id}/reject", auth(http.HandlerFunc(s.rejectQuarantinedHandler)))
+}
+
+// requireToken пропускает только запросы с заголовком "Authorization: Bearer <token>".
+func requireToken(token string) func(http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// listDLQHandler возвращает сообщения DLQ с метаданными ошибки.
+// Параметры запроса: reason (подстрока причины), order_uid, from, to (RFC3339), limit,
+// include_replayed (true - включить уже переотправленные сообщения).
+func (s *Server) listDLQHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := kafka.ReplayFilter{
+		Reason:   q.Get("reason"),
+		OrderUID: q.Get("order_uid"),
+	}
+
+	var err error
+	if v := q.Get("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "Некорректный from, ожидается RFC3339", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "Некорректный to, ожидается RFC3339", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 {
+			http.Error(w, "Некорректный limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("include_replayed"); v != "" {
+		if filter.IncludeReplayed, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "Некорректный include_replayed", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), kafka.DefaultReplayTimeout)
+	defer cancel()
+	msgs, err := s.dlq.List(ctx, filter)
+	if err != nil {
+		sendDLQError(w, "Ошибка чтения DLQ", err)
+		return
+	}
+	if msgs == nil {
+		msgs = []kafka.DLQMessage{}
+	}
+	sendJSONResponse(w, msgs)
+}
+
+// replayDLQHandler переотправляет выбранные сообщения DLQ в основной топик.
+// Тело запроса - фильтр (reason, order_uid, from, to, positions, limit, include_replayed) и dry_run.
+func (s *Server) replayDLQHandler(w http.ResponseWriter, r *http.Request) {
+	var req replayRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxIngestBodySize)).Decode(&req); err != nil {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), kafka.DefaultReplayTimeout)
+	defer cancel()
+	res, err := s.dlq.Replay(ctx, req.ReplayFilter, req.DryRun)
+	if err != nil {
+		sendDLQError(w, "Ошибка переотправки сообщений DLQ", err)
+		return
+	}
+	if res.Messages == nil {
+		res.Messages = []kafka.DLQMessage{}
+	}
+	if !res.DryRun {
+		log.Printf("Из DLQ переотправлено сообщений: %d", len(res.Messages))
+	}
+	sendJSONResponse(w, res)
+}
+
+// sendDLQError отвечает на ошибку чтения или переотправки DLQ; если DLQ не удалось
+// прочитать за kafka.DefaultReplayTimeout, возвращается 504.
+func sendDLQError(w http.ResponseWriter, what string, err error) {
+	log.Printf("%s: %v", what, err)
+	if errors.Is(err, context.DeadlineExceeded) {
+		http.Error(w, "Превышено время чтения DLQ", http.StatusGatewayTimeout)
+		return
+	}
+	http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+}
+
+// listQuarantineHandler возвращает заказы в карантине, от новых к старым.
+// Параметры запроса: status (pending, approved, rejected), order_uid, limit.
+func (s *Server) listQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := db.QuarantineFilter{
+		Status:   db.QuarantineStatus(q.Get("status")),
+		OrderUID: q.Get("order_uid"),
+	}
+	switch filter.Status {
+	case "", db.QuarantinePending, db.QuarantineApproved, db.QuarantineRejected:
+	default:
+		http.Error(w, "Некорректный status, ожидается pending, approved или rejected", http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("limit"); v != "" {
+		var err error
+		filter.Limit, err = strconv.Atoi(v)
+		if err != nil || filter.Limit <= 0 || filter.Limit > db.MaxListLimit {
+			http.Error(w, "Некорректный limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	orders, err := s.db.ListQuarantine(r.Context(), filter)
+	if err != nil {
+		log.Printf("Ошибка при получении карантина: %v", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	if orders == nil {
+		orders = []*db.QuarantinedOrder{}
+	}
+	sendJSONResponse(w, orders)
+}
+
+// getQuarantinedHandler возвращает заказ в карантине с нарушенными правилами.
+func (s *Server) getQuarantinedHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := quarantineID(w, r)
+	if !ok {
+		return
+	}
+	q, err := s.db.GetQuarantined(r.Context(), id)
+	if err != nil {
+		sendQuarantineError(w, err)
+		return
+	}
+	sendJSONResponse(w, q)
+}
+
+// approveQuarantinedHandler переносит заказ из карантина в основные таблицы и кэш
+// и возвращает сохраненный заказ. Тело запроса (необязательно) - {"note": "..."}.
+func (s *Server) approveQuarantinedHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := quarantineID(w, r)
+	if !ok {
+		return
+	}
+	req, ok := decodeReview(w, r)
+	if !ok {
+		return
+	}
+
+	order, err := s.db.ApproveQuarantined(r.Context(), id, req.Note)
+	if err != nil {
+		sendQuarantineError(w, err)
+		return
+	}
+	s.cache.Set(order.OrderUID, order)
+	log.Printf("Заказ %s одобрен и перенесен из карантина (id %d)", order.OrderUID, id)
+	sendJSONResponse(w, order)
+}
+
+// rejectQuarantinedHandler отклоняет заказ в карантине. Тело запроса (необязательно) - {"note": "..."}.
+func (s *Server) rejectQuarantinedHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := quarantineID(w, r)
+	if !ok {
+		return
+	}
+	req, ok := decodeReview(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.db.RejectQuarantined(r.Context(), id, req.Note); err != nil {
+		sendQuarantineError(w, err)
+		return
+	}
+	log.Printf("Заказ в карантине отклонен (id %d)", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// quarantineID разбирает id записи карантина из пути; при ошибке отвечает 400.
+func quarantineID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "Некорректный id записи карантина", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// decodeReview разбирает необязательное тело запроса проверки; при ошибке отвечает 400.
+func decodeReview(w http.ResponseWriter, r *http.Request) (reviewRequest, bool) {
+	var req reviewRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxIngestBodySize)).Decode(&req)
+	if err != nil && err != io.EOF {
+		http.Error(w, "Некорректное тело запроса", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// sendQuarantineError сопоставляет ошибку операции с карантином с HTTP-статусом.
+func sendQuarantineError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, db.ErrQuarantineNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, db.ErrQuarantineReviewed), errors.Is(err, db.ErrStaleVersion):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Ошибка операции с карантином: %v", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+	}
+}
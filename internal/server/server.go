@@ -1,32 +1,59 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/112Alex/demo-service.git/internal/cache"
 	"github.com/112Alex/demo-service.git/internal/db"
+	"github.com/112Alex/demo-service.git/internal/health"
+	"github.com/112Alex/demo-service.git/internal/ingest"
+	"github.com/112Alex/demo-service.git/internal/kafka"
+	"github.com/112Alex/demo-service.git/internal/model"
 )
 
+// maxIngestBodySize ограничивает размер тела POST /orders.
+const maxIngestBodySize = 10 << 20
+
 // Server представляет собой HTTP-сервер, который имеет доступ к кэшу и БД.
 type Server struct {
 	httpServer *http.Server
 	cache      *cache.Cache
 	db         *db.DBClient
+	ingest     *ingest.Service
+	health     *health.Registry
+	dlq        *kafka.DLQ
 }
 
 // NewServer создает и возвращает новый HTTP-сервер.
-func NewServer(port string, cache *cache.Cache, db *db.DBClient) *Server {
+// Административный API (см. Admin) доступен только при заданном токене.
+func NewServer(port string, cache *cache.Cache, db *db.DBClient, svc *ingest.Service, checks *health.Registry, admin Admin) *Server {
 	router := http.NewServeMux()
 	s := &Server{
-		cache: cache,
-		db:    db,
+		cache:  cache,
+		db:     db,
+		ingest: svc,
+		health: checks,
 	}
 
+	router.HandleFunc("GET /health", s.healthHandler)
+
 	router.HandleFunc("/order/", s.orderHandler)
+	router.HandleFunc("GET /order/{order_uid}/history", s.orderHistoryHandler)
+	router.HandleFunc("GET /orders", s.listOrdersHandler)
+	router.HandleFunc("POST /orders", s.createOrdersHandler)
+	router.HandleFunc("GET /orders/by-track/{track_number}", s.ordersByTrackHandler)
+	router.HandleFunc("GET /customers/{customer_id}/orders", s.customerOrdersHandler)
+
+	s.registerAdmin(router, admin)
 
 	fs := http.FileServer(http.Dir("./web/static"))
 	router.Handle("/static/", http.StripPrefix("/static/", fs))
@@ -60,6 +87,20 @@ func (s *Server) homeHandler(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "./web/static/index.html")
 }
 
+// healthHandler возвращает состояние сервиса и его компонентов (включая прогресс прогрева кэша).
+// Отвечает 503, если хотя бы один компонент недоступен.
+func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	status, components := s.health.Check()
+	code := http.StatusOK
+	if status == health.StatusDown {
+		code = http.StatusServiceUnavailable
+	}
+	sendJSONStatus(w, code, map[string]interface{}{
+		"status":     status,
+		"components": components,
+	})
+}
+
 // orderHandler обрабатывает запросы на получение заказа по order_uid.
 func (s *Server) orderHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -99,6 +140,197 @@ func (s *Server) orderHandler(w http.ResponseWriter, r *http.Request) {
 	sendJSONResponse(w, order)
 }
 
+// orderHistoryHandler возвращает историю статусов заказа в порядке изменений.
+func (s *Server) orderHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	orderUID := r.PathValue("order_uid")
+
+	history, err := s.db.GetStatusHistory(r.Context(), orderUID)
+	if err != nil {
+		log.Printf("Ошибка при получении истории статусов заказа %s: %v", orderUID, err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	if len(history) == 0 {
+		http.Error(w, "Заказ не найден", http.StatusNotFound)
+		return
+	}
+
+	sendJSONResponse(w, history)
+}
+
+// listOrdersHandler возвращает страницу заказов с фильтрами и курсорной пагинацией.
+// Параметры запроса: customer_id, track_number, delivery_service, locale,
+// date_from, date_to (RFC3339), cursor, limit.
+func (s *Server) listOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := db.OrderFilter{
+		CustomerID:      q.Get("customer_id"),
+		TrackNumber:     q.Get("track_number"),
+		DeliveryService: q.Get("delivery_service"),
+		Locale:          q.Get("locale"),
+		Cursor:          q.Get("cursor"),
+	}
+
+	var err error
+	if v := q.Get("date_from"); v != "" {
+		if filter.CreatedFrom, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "Некорректный date_from, ожидается RFC3339", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("date_to"); v != "" {
+		if filter.CreatedTo, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "Некорректный date_to, ожидается RFC3339", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		filter.Limit, err = strconv.Atoi(v)
+		if err != nil || filter.Limit <= 0 || filter.Limit > db.MaxListLimit {
+			http.Error(w, "Некорректный limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := s.db.ListOrders(r.Context(), filter)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Ошибка при получении списка заказов: %v", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	sendJSONResponse(w, page)
+}
+
+// ordersByTrackHandler возвращает все заказы с указанным трек-номером.
+func (s *Server) ordersByTrackHandler(w http.ResponseWriter, r *http.Request) {
+	trackNumber := r.PathValue("track_number")
+
+	orders, found := s.cache.GetByTrackNumber(trackNumber)
+	if found {
+		log.Printf("Заказы с трек-номером %s найдены в кэше", trackNumber)
+	} else {
+		var err error
+		orders, err = s.db.GetOrdersByTrackNumber(r.Context(), trackNumber)
+		if err != nil {
+			log.Printf("Ошибка при получении заказов по трек-номеру %s из БД: %v", trackNumber, err)
+			http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+			return
+		}
+		// Пустой результат тоже кэшируется, чтобы неизвестный трек-номер не нагружал БД
+		s.cache.SetByTrackNumber(trackNumber, orders)
+	}
+
+	if len(orders) == 0 {
+		http.Error(w, "Заказы не найдены", http.StatusNotFound)
+		return
+	}
+	sendJSONResponse(w, orders)
+}
+
+// customerOrdersHandler возвращает все заказы покупателя.
+// Пустой список - корректный ответ для покупателя без заказов.
+func (s *Server) customerOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	customerID := r.PathValue("customer_id")
+
+	orders, found := s.cache.GetByCustomerID(customerID)
+	if found {
+		log.Printf("Заказы покупателя %s найдены в кэше", customerID)
+		sendJSONResponse(w, orders)
+		return
+	}
+
+	orders, err := s.db.GetOrdersByCustomerID(r.Context(), customerID)
+	if err != nil {
+		log.Printf("Ошибка при получении заказов покупателя %s из БД: %v", customerID, err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	if orders == nil {
+		orders = []*model.Order{}
+	}
+
+	s.cache.SetByCustomerID(customerID, orders)
+	sendJSONResponse(w, orders)
+}
+
+// createOrdersHandler принимает один заказ (JSON-объект) или пакет заказов (JSON-массив)
+// и прогоняет их через тот же конвейер, что и потребитель Kafka.
+// Новый заказ дает 201, существующий заменяется (см. db.SaveOrder) с ответом 200, устаревшая версия дает 409,
+// повторно полученный заказ - 200 без изменений.
+// Заказ, нарушивший бизнес-правила со строгостью quarantine, помещается в карантин (202).
+// Для одного заказа отвечает 200/201/202/409/422/500; для пакета возвращает результаты по каждому
+// заказу с общим кодом, если он у всех совпадает, и 207 Multi-Status иначе.
+func (s *Server) createOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIngestBodySize))
+	if err != nil {
+		http.Error(w, "Не удалось прочитать тело запроса", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '[' {
+		res := s.ingest.Ingest(r.Context(), body)
+		sendJSONStatus(w, ingestStatusCode(res.Status), res)
+		return
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil {
+		http.Error(w, "Некорректный JSON-массив заказов", http.StatusBadRequest)
+		return
+	}
+	if len(batch) == 0 {
+		http.Error(w, "Пустой пакет заказов", http.StatusBadRequest)
+		return
+	}
+
+	results := make([]ingest.Result, 0, len(batch))
+	code := 0
+	for _, raw := range batch {
+		res := s.ingest.Ingest(r.Context(), raw)
+		results = append(results, res)
+		switch c := ingestStatusCode(res.Status); {
+		case code == 0:
+			code = c
+		case code != c:
+			code = http.StatusMultiStatus
+		}
+	}
+	sendJSONStatus(w, code, results)
+}
+
+// ingestStatusCode сопоставляет результат приема заказа с HTTP-статусом.
+func ingestStatusCode(status ingest.Status) int {
+	switch status {
+	case ingest.StatusCreated:
+		return http.StatusCreated
+	case ingest.StatusUpdated, ingest.StatusDuplicate:
+		return http.StatusOK
+	case ingest.StatusQuarantined:
+		return http.StatusAccepted
+	case ingest.StatusStale:
+		return http.StatusConflict
+	case ingest.StatusInvalid:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// sendJSONStatus отправляет ответ в формате JSON с указанным статусом.
+func sendJSONStatus(w http.ResponseWriter, code int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("Не удалось сериализовать JSON: %v", err)
+	}
+}
+
 // sendJSONResponse отправляет ответ в формате JSON.
 func sendJSONResponse(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,157 @@
+package warmup
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/cache"
+	"github.com/112Alex/demo-service.git/internal/db"
+	"github.com/112Alex/demo-service.git/internal/health"
+	"github.com/112Alex/demo-service.git/internal/model"
+)
+
+// Policy selects which orders are loaded into the cache at startup.
+type Policy string
+
+const (
+	// PolicyNone skips warm-up: the cache is filled lazily by lookups.
+	PolicyNone Policy = "none"
+	// PolicyRecent loads the Limit most recent orders by date_created.
+	PolicyRecent Policy = "recent"
+	// PolicyWindow loads orders created within Window, newest first, up to Limit.
+	PolicyWindow Policy = "window"
+)
+
+// State is the warm-up lifecycle stage.
+type State string
+
+const (
+	StatePending State = "pending"
+	StateRunning State = "running"
+	StateDone    State = "done"
+	StateFailed  State = "failed"
+	StateSkipped State = "skipped"
+)
+
+// Progress is a snapshot of warm-up progress.
+type Progress struct {
+	Policy     Policy     `json:"policy"`
+	State      State      `json:"state"`
+	Loaded     int        `json:"loaded"`
+	Target     int        `json:"target"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Loader streams orders from storage. Implemented by *db.DBClient.
+type Loader interface {
+	ForEachOrderBatch(ctx context.Context, scan db.OrderScan, fn func([]*model.Order) error) error
+}
+
+// Options configure a Warmer.
+type Options struct {
+	Policy    Policy
+	Limit     int           // upper bound on loaded orders; clamped to cache capacity
+	Window    time.Duration // look-back for PolicyWindow
+	BatchSize int
+}
+
+// Warmer fills the cache according to a policy and reports its progress.
+type Warmer struct {
+	loader   Loader
+	cache    *cache.Cache
+	opts     Options
+	capacity int
+
+	mu       sync.RWMutex
+	progress Progress
+}
+
+// NewWarmer creates a warmer for a cache holding at most capacity orders.
+func NewWarmer(loader Loader, c *cache.Cache, capacity int, opts Options) *Warmer {
+	if opts.Limit <= 0 || opts.Limit > capacity {
+		opts.Limit = capacity
+	}
+	return &Warmer{
+		loader:   loader,
+		cache:    c,
+		opts:     opts,
+		capacity: capacity,
+		progress: Progress{Policy: opts.Policy, State: StatePending, Target: opts.Limit},
+	}
+}
+
+// Run performs the warm-up. It blocks until done and is meant to be started in
+// a goroutine so the HTTP server becomes ready immediately.
+func (w *Warmer) Run(ctx context.Context) {
+	if w.opts.Policy == PolicyNone {
+		w.update(func(p *Progress) { p.State = StateSkipped; p.Target = 0 })
+		log.Println("Прогрев кэша отключен")
+		return
+	}
+
+	scan := db.OrderScan{Limit: w.opts.Limit, BatchSize: w.opts.BatchSize}
+	if w.opts.Policy == PolicyWindow {
+		scan.Since = time.Now().Add(-w.opts.Window)
+	}
+
+	started := time.Now()
+	w.update(func(p *Progress) { p.State = StateRunning; p.StartedAt = &started })
+	log.Printf("Прогрев кэша (политика %s, не более %d заказов)...", w.opts.Policy, w.opts.Limit)
+
+	err := w.loader.ForEachOrderBatch(ctx, scan, func(orders []*model.Order) error {
+		for _, order := range orders {
+			// Orders written by the consumer during warm-up are newer than this snapshot.
+			// Orders come newest first and each is added behind the previous one,
+			// so the oldest are evicted first.
+			w.cache.SetIfAbsent(order.OrderUID, order)
+		}
+		w.update(func(p *Progress) { p.Loaded += len(orders) })
+		return ctx.Err()
+	})
+
+	finished := time.Now()
+	w.update(func(p *Progress) {
+		p.FinishedAt = &finished
+		if err != nil {
+			p.State = StateFailed
+			p.Error = err.Error()
+		} else {
+			p.State = StateDone
+		}
+	})
+
+	p := w.Progress()
+	if err != nil {
+		log.Printf("Ошибка прогрева кэша (загружено %d заказов): %v", p.Loaded, err)
+		return
+	}
+	log.Printf("Прогрев кэша завершен за %s. Загружено %d заказов.", finished.Sub(started).Round(time.Millisecond), p.Loaded)
+}
+
+// Progress returns a snapshot of the current progress.
+func (w *Warmer) Progress() Progress {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.progress
+}
+
+// Health implements health.Checker. A failed warm-up only degrades the
+// service: lookups still fall back to the database.
+func (w *Warmer) Health() health.Report {
+	p := w.Progress()
+	status := health.StatusUp
+	if p.State == StateFailed {
+		status = health.StatusDegraded
+	}
+	return health.Report{Status: status, Details: p}
+}
+
+func (w *Warmer) update(fn func(p *Progress)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fn(&w.progress)
+}
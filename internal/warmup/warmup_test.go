@@ -0,0 +1,79 @@
+package warmup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/112Alex/demo-service.git/internal/cache"
+	"github.com/112Alex/demo-service.git/internal/db"
+	"github.com/112Alex/demo-service.git/internal/model"
+)
+
+type mockLoader struct {
+	scan db.OrderScan
+}
+
+func (m *mockLoader) ForEachOrderBatch(ctx context.Context, scan db.OrderScan, fn func([]*model.Order) error) error {
+	m.scan = scan
+	return fn([]*model.Order{{OrderUID: "1"}, {OrderUID: "2"}})
+}
+
+func TestWarmer_RecentClampedToCapacity(t *testing.T) {
+	loader := &mockLoader{}
+	c := cache.NewCache(10, 0)
+	w := NewWarmer(loader, c, 10, Options{Policy: PolicyRecent, Limit: 1000})
+
+	w.Run(context.Background())
+
+	if loader.scan.Limit != 10 {
+		t.Errorf("Ожидался лимит 10, получен %d", loader.scan.Limit)
+	}
+	if !loader.scan.Since.IsZero() {
+		t.Error("Политика recent не должна ограничивать дату")
+	}
+	p := w.Progress()
+	if p.State != StateDone || p.Loaded != 2 {
+		t.Errorf("Ожидалось done/2, получено %s/%d", p.State, p.Loaded)
+	}
+	if _, ok := c.Get("2"); !ok {
+		t.Error("Заказ 2 должен быть в кэше")
+	}
+}
+
+func TestWarmer_Window(t *testing.T) {
+	loader := &mockLoader{}
+	w := NewWarmer(loader, cache.NewCache(10, 0), 10, Options{Policy: PolicyWindow, Window: time.Hour})
+
+	w.Run(context.Background())
+
+	if age := time.Since(loader.scan.Since); age < time.Hour || age > time.Hour+time.Minute {
+		t.Errorf("Ожидалось окно в 1 час, получено %s", age)
+	}
+}
+
+func TestWarmer_None(t *testing.T) {
+	loader := &mockLoader{}
+	w := NewWarmer(loader, cache.NewCache(10, 0), 10, Options{Policy: PolicyNone})
+
+	w.Run(context.Background())
+
+	if p := w.Progress(); p.State != StateSkipped || p.Loaded != 0 {
+		t.Errorf("Ожидалось skipped/0, получено %s/%d", p.State, p.Loaded)
+	}
+}
+
+func TestWarmer_RecentEvictedLast(t *testing.T) {
+	c := cache.NewCache(2, 0)
+	w := NewWarmer(&mockLoader{}, c, 2, Options{Policy: PolicyRecent, Limit: 2})
+
+	w.Run(context.Background())
+	c.Set("3", &model.Order{OrderUID: "3"})
+
+	if _, ok := c.Get("1"); !ok {
+		t.Error("Самый новый заказ 1 должен остаться в кэше")
+	}
+	if _, ok := c.Get("2"); ok {
+		t.Error("Более старый заказ 2 должен быть вытеснен первым")
+	}
+}